@@ -177,10 +177,12 @@ func (svr *FakeServer) handleAPIObject(w http.ResponseWriter, r *http.Request) {
 		svr.handleGet(id).ServeHTTP(w, r)
 	case "PUT":
 		svr.handlePut(id).ServeHTTP(w, r)
+	case "PATCH":
+		svr.handlePatch(id).ServeHTTP(w, r)
 	case "DELETE":
 		svr.handleDelete(id).ServeHTTP(w, r)
 	default:
-		http.Error(w, "Only GET and PUT are allowed on object", http.StatusMethodNotAllowed)
+		http.Error(w, "Only GET, PUT, PATCH and DELETE are allowed on object", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -225,6 +227,53 @@ func (svr *FakeServer) handlePut(id string) http.Handler {
 	})
 }
 
+func (svr *FakeServer) handlePatch(id string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svr.log.Debugf("PATCH")
+		obj, ok := svr.objects[id]
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		b := r.Context().Value(keyRequestBody).([]byte)
+		svr.log.Debugf("data sent - unmarshalling from JSON: %s\n", string(b))
+
+		var patch map[string]interface{}
+		if err := json.Unmarshal(b, &patch); err != nil {
+			svr.log.Debugf("Unmarshal of request failed: %s\n", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		/* Apply as a JSON merge patch (RFC 7396) */
+		svr.log.Debugf("Patching %s with:%+v\n", id, patch)
+		svr.objects[id] = mergePatch(obj, patch)
+
+		b, _ = json.Marshal(svr.objects[id])
+		w.Write(b)
+	})
+}
+
+/* Apply an RFC 7396 merge patch: null removes a key, objects
+   are merged recursively and anything else replaces the value */
+func mergePatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+		} else if patchMap, ok := v.(map[string]interface{}); ok {
+			targetMap, _ := target[k].(map[string]interface{})
+			target[k] = mergePatch(targetMap, patchMap)
+		} else {
+			target[k] = v
+		}
+	}
+	return target
+}
+
 func (svr *FakeServer) handleDelete(id string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		svr.log.Debugf("DELETE")
@@ -2,50 +2,146 @@ package restapi
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type apiClientOpt struct {
-	uri                   string
-	insecure              bool
-	username              string
-	password              string
-	headers               map[string]string
-	use_cookie            bool
-	timeout               int
-	id_attribute          string
-	copy_keys             []string
-	write_returns_object  bool
-	create_returns_object bool
-	xssi_prefix           string
-	use_cookies           bool
-	debug                 bool
+	uri                        string
+	insecure                   bool
+	username                   string
+	password                   string
+	headers                    map[string]string
+	timeout                    int
+	id_attribute               string
+	copy_keys                  []string
+	write_returns_object       bool
+	create_returns_object      bool
+	xssi_prefix                string
+	response_object_key        string
+	request_wrapper_key        string
+	use_cookies                bool
+	max_redirects              int
+	allow_cross_host_redirects bool
+	retry_max                  int
+	retry_backoff_base_ms      int
+	retry_backoff_max_ms       int
+	retry_jitter               bool
+	retry_status_codes         []int
+	retry_non_idempotent       bool
+	rate_limit                 float64
+	rate_limit_burst           int
+	max_concurrent_requests    int
+	oauth_client_id            string
+	oauth_client_secret        string
+	oauth_scopes               []string
+	oauth_token_endpoint       string
+	oauth_endpoint_params      url.Values
+	ca_cert_file               string
+	ca_cert_pem                string
+	client_cert_file           string
+	client_key_file            string
+	client_cert_pem            string
+	client_key_pem             string
+	tls_min_version            string
+	tls_server_name            string
+	login                      *loginOpt
+	create_method              string
+	read_method                string
+	update_method              string
+	destroy_method             string
+	debug                      bool
 }
 
 type api_client struct {
-	http_client           *http.Client
-	uri                   string
-	insecure              bool
-	username              string
-	password              string
-	headers               map[string]string
-	redirects             int
-	use_cookie            bool
-	timeout               int
-	id_attribute          string
-	copy_keys             []string
-	write_returns_object  bool
-	create_returns_object bool
-	xssi_prefix           string
-	debug                 bool
+	http_client                *http.Client
+	uri                        string
+	insecure                   bool
+	username                   string
+	password                   string
+	headers                    map[string]string
+	redirects                  int
+	allow_cross_host_redirects bool
+	retry_max                  int
+	retry_backoff_base         time.Duration
+	retry_backoff_max          time.Duration
+	retry_jitter               bool
+	retry_status_codes         []int
+	retry_non_idempotent       bool
+	rate_limiter               *rate_limiter
+	in_flight                  chan struct{}
+	oauth_config               *clientcredentials.Config
+	oauth_token_source         oauth2.TokenSource
+	login                      *loginOpt
+	login_mutex                sync.Mutex
+	login_session              string
+	login_generation           int
+	create_method              string
+	read_method                string
+	update_method              string
+	destroy_method             string
+	timeout                    int
+	id_attribute               string
+	copy_keys                  []string
+	write_returns_object       bool
+	create_returns_object      bool
+	xssi_prefix                string
+	response_object_key        string
+	request_wrapper_key        string
+	debug                      bool
+}
+
+/* Returned by send_request when the API answers with an
+   unexpected response code so callers can act on the status
+   (such as a 404 on delete) instead of parsing the message */
+type api_error struct {
+	status_code int
+	method      string
+	url         string
+	headers     http.Header
+	body        string
+}
+
+func (err *api_error) Error() string {
+	return fmt.Sprintf("Unexpected response code '%d' from %s %s: %s", err.status_code, err.method, err.url, err.body)
+}
+
+/* A successful response as returned by send_request_full */
+type api_response struct {
+	status_code int
+	headers     http.Header
+	body        string
+	url         *url.URL /* Where the response came from, after any redirects */
+}
+
+/* Whether err is an api_error carrying one of the status codes */
+func is_api_error_status(err error, codes ...int) bool {
+	api_err, ok := err.(*api_error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if api_err.status_code == code {
+			return true
+		}
+	}
+	return false
 }
 
 // Make a new api client for RESTful calls
@@ -69,9 +165,62 @@ func NewAPIClient(opt *apiClientOpt) (*api_client, error) {
 		opt.uri = opt.uri[:len(opt.uri)-1]
 	}
 
-	/* Disable TLS verification if requested */
+	/* Sane defaults for the methods of each operation */
+	if opt.create_method == "" {
+		opt.create_method = "POST"
+	}
+	if opt.read_method == "" {
+		opt.read_method = "GET"
+	}
+	if opt.update_method == "" {
+		opt.update_method = "PUT"
+	}
+	if opt.destroy_method == "" {
+		opt.destroy_method = "DELETE"
+	}
+
+	/* Sane default for redirects. As 0 means unset here,
+	   a negative value is used to not follow any redirect */
+	if opt.max_redirects == 0 {
+		opt.max_redirects = 5
+	} else if opt.max_redirects < 0 {
+		opt.max_redirects = 0
+	}
+
+	if opt.retry_max < 0 {
+		return nil, errors.New("retry_max cannot be negative")
+	}
+
+	/* Sane defaults for retries. These only matter if retry_max is set */
+	if opt.retry_backoff_base_ms <= 0 {
+		opt.retry_backoff_base_ms = 500
+	}
+	if opt.retry_backoff_max_ms <= 0 {
+		opt.retry_backoff_max_ms = 30000
+	}
+	if len(opt.retry_status_codes) == 0 {
+		opt.retry_status_codes = []int{429, 502, 503, 504}
+	}
+
+	if opt.rate_limit < 0 {
+		return nil, errors.New("rate_limit cannot be negative")
+	}
+	if opt.max_concurrent_requests < 0 {
+		return nil, errors.New("max_concurrent_requests cannot be negative")
+	}
+
+	if opt.login != nil {
+		if err := validate_login_opt(opt.login, opt.use_cookies); err != nil {
+			return nil, err
+		}
+	}
+
+	tls_config, err := build_tls_config(opt)
+	if err != nil {
+		return nil, err
+	}
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: opt.insecure},
+		TLSClientConfig: tls_config,
 	}
 
 	var cookieJar http.CookieJar
@@ -85,19 +234,63 @@ func NewAPIClient(opt *apiClientOpt) (*api_client, error) {
 			Timeout:   time.Second * time.Duration(opt.timeout),
 			Transport: tr,
 			Jar:       cookieJar,
+			/* Redirects are followed by send_request so it can
+			   control method rewrites and where credentials go */
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
 		},
-		uri:                   opt.uri,
-		insecure:              opt.insecure,
-		username:              opt.username,
-		password:              opt.password,
-		headers:               opt.headers,
-		id_attribute:          opt.id_attribute,
-		copy_keys:             opt.copy_keys,
-		write_returns_object:  opt.write_returns_object,
-		create_returns_object: opt.create_returns_object,
-		xssi_prefix:           opt.xssi_prefix,
-		debug:                 opt.debug,
-		redirects:             5,
+		uri:                        opt.uri,
+		insecure:                   opt.insecure,
+		username:                   opt.username,
+		password:                   opt.password,
+		headers:                    opt.headers,
+		id_attribute:               opt.id_attribute,
+		copy_keys:                  opt.copy_keys,
+		write_returns_object:       opt.write_returns_object,
+		create_returns_object:      opt.create_returns_object,
+		xssi_prefix:                opt.xssi_prefix,
+		response_object_key:        opt.response_object_key,
+		request_wrapper_key:        opt.request_wrapper_key,
+		debug:                      opt.debug,
+		redirects:                  opt.max_redirects,
+		allow_cross_host_redirects: opt.allow_cross_host_redirects,
+		retry_max:                  opt.retry_max,
+		retry_backoff_base:         time.Millisecond * time.Duration(opt.retry_backoff_base_ms),
+		retry_backoff_max:          time.Millisecond * time.Duration(opt.retry_backoff_max_ms),
+		retry_jitter:               opt.retry_jitter,
+		retry_status_codes:         opt.retry_status_codes,
+		retry_non_idempotent:       opt.retry_non_idempotent,
+		login:                      opt.login,
+		create_method:              opt.create_method,
+		read_method:                opt.read_method,
+		update_method:              opt.update_method,
+		destroy_method:             opt.destroy_method,
+	}
+
+	/* Every resource and data source shares this client, so
+	   throttling here applies to the whole terraform run */
+	if opt.rate_limit > 0 {
+		client.rate_limiter = new_rate_limiter(opt.rate_limit, opt.rate_limit_burst)
+	}
+	if opt.max_concurrent_requests > 0 {
+		client.in_flight = make(chan struct{}, opt.max_concurrent_requests)
+	}
+
+	if opt.oauth_client_id != "" && opt.oauth_client_secret != "" && opt.oauth_token_endpoint != "" {
+		client.oauth_config = &clientcredentials.Config{
+			ClientID:       opt.oauth_client_id,
+			ClientSecret:   opt.oauth_client_secret,
+			TokenURL:       opt.oauth_token_endpoint,
+			Scopes:         opt.oauth_scopes,
+			EndpointParams: opt.oauth_endpoint_params,
+		}
+
+		/* Fetch tokens with the same transport (TLS settings, timeout)
+		   as the API itself. The token source caches the token, refreshes
+		   it shortly before it expires and is safe for concurrent use */
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client.http_client)
+		client.oauth_token_source = client.oauth_config.TokenSource(ctx)
 	}
 
 	if opt.debug {
@@ -117,6 +310,27 @@ func (obj *api_client) toString() string {
 	buffer.WriteString(fmt.Sprintf("id_attribute: %s\n", obj.id_attribute))
 	buffer.WriteString(fmt.Sprintf("write_returns_object: %t\n", obj.write_returns_object))
 	buffer.WriteString(fmt.Sprintf("create_returns_object: %t\n", obj.create_returns_object))
+	buffer.WriteString(fmt.Sprintf("response_object_key: %s\n", obj.response_object_key))
+	buffer.WriteString(fmt.Sprintf("request_wrapper_key: %s\n", obj.request_wrapper_key))
+	buffer.WriteString(fmt.Sprintf("methods: create=%s, read=%s, update=%s, destroy=%s\n", obj.create_method, obj.read_method, obj.update_method, obj.destroy_method))
+	buffer.WriteString(fmt.Sprintf("max_redirects: %d\n", obj.redirects))
+	buffer.WriteString(fmt.Sprintf("allow_cross_host_redirects: %t\n", obj.allow_cross_host_redirects))
+	buffer.WriteString(fmt.Sprintf("retry_max: %d\n", obj.retry_max))
+	buffer.WriteString(fmt.Sprintf("retry_backoff: %s - %s (jitter: %t)\n", obj.retry_backoff_base, obj.retry_backoff_max, obj.retry_jitter))
+	buffer.WriteString(fmt.Sprintf("retry_status_codes: %v\n", obj.retry_status_codes))
+	buffer.WriteString(fmt.Sprintf("retry_non_idempotent: %t\n", obj.retry_non_idempotent))
+	if obj.rate_limiter != nil {
+		buffer.WriteString(fmt.Sprintf("rate_limit: %g/s (burst: %g)\n", obj.rate_limiter.rate, obj.rate_limiter.burst))
+	}
+	buffer.WriteString(fmt.Sprintf("max_concurrent_requests: %d\n", cap(obj.in_flight)))
+	if obj.oauth_config != nil {
+		buffer.WriteString(fmt.Sprintf("oauth_token_endpoint: %s\n", obj.oauth_config.TokenURL))
+		buffer.WriteString(fmt.Sprintf("oauth_client_id: %s\n", obj.oauth_config.ClientID))
+		buffer.WriteString(fmt.Sprintf("oauth_scopes: %v\n", obj.oauth_config.Scopes))
+	}
+	if obj.login != nil {
+		buffer.WriteString(fmt.Sprintf("login: %s %s\n", obj.login.method, obj.login.path))
+	}
 	buffer.WriteString(fmt.Sprintf("headers:\n"))
 	for k, v := range obj.headers {
 		buffer.WriteString(fmt.Sprintf("  %s: %s\n", k, v))
@@ -128,10 +342,39 @@ func (obj *api_client) toString() string {
 }
 
 /* Helper function that handles sending/receiving and handling
-   of HTTP data in and out.
-   TODO: Handle redirects */
+   of HTTP data in and out. Redirects are followed here (up to
+   max_redirects) rather than by the golang http client */
 func (client *api_client) send_request(method string, path string, data string) (string, error) {
+	return client.send_request_with_headers(method, path, data, nil)
+}
+
+/* Same as send_request, but also sets the given headers on the
+   request after (and so over) the client-wide headers */
+func (client *api_client) send_request_with_headers(method string, path string, data string, headers map[string]string) (string, error) {
+	resp, err := client.send_request_full(method, path, data, headers)
+	if err != nil {
+		return "", err
+	}
+	return resp.body, nil
+}
+
+/* Same as send_request_with_headers, but returns the status code
+   and headers of the final response along with the body. The path
+   may also be an absolute URL on the same host as the provider's uri
+   (or any host with allow_cross_host_redirects), as found in Location headers */
+func (client *api_client) send_request_full(method string, path string, data string, headers map[string]string) (*api_response, error) {
 	full_uri := client.uri + path
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		target, err := url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		base, _ := url.Parse(client.uri)
+		if !client.allow_cross_host_redirects && !same_host(base, target) {
+			return nil, fmt.Errorf("Refusing to send a request to '%s' which is not on the same host as '%s' (see allow_cross_host_redirects)", path, client.uri)
+		}
+		full_uri = path
+	}
 	var req *http.Request
 	var err error
 
@@ -152,8 +395,7 @@ func (client *api_client) send_request(method string, path string, data string)
 	}
 
 	if err != nil {
-		log.Fatal(err)
-		return "", err
+		return nil, err
 	}
 
 	if client.debug {
@@ -166,12 +408,35 @@ func (client *api_client) send_request(method string, path string, data string)
 			req.Header.Set(n, v)
 		}
 	}
+	for n, v := range headers {
+		req.Header.Set(n, v)
+	}
+
+	/* Bearer token from the OAuth2 client credentials flow */
+	if client.oauth_token_source != nil {
+		token, err := client.oauth_token_source.Token()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get an OAuth2 token from '%s': %s", client.oauth_config.TokenURL, err)
+		}
+		token.SetAuthHeader(req)
+	}
 
 	if client.username != "" && client.password != "" {
 		/* ... and fall back to basic auth if configured */
 		req.SetBasicAuth(client.username, client.password)
 	}
 
+	/* Session token from the login endpoint */
+	login_generation := 0
+	session := ""
+	if client.login != nil {
+		session, login_generation, err = client.login_token()
+		if err != nil {
+			return nil, err
+		}
+		client.apply_login(req, session)
+	}
+
 	if client.debug {
 		log.Printf("api_client.go: Request headers:\n")
 		for name, headers := range req.Header {
@@ -189,11 +454,11 @@ func (client *api_client) send_request(method string, path string, data string)
 	}
 
 	for num_redirects := client.redirects; num_redirects >= 0; num_redirects-- {
-		resp, err := client.http_client.Do(req)
+		resp, err := client.do_request(req)
 
 		if err != nil {
 			//log.Printf("api_client.go: Error detected: %s\n", err)
-			return "", err
+			return nil, err
 		}
 
 		if client.debug {
@@ -210,23 +475,360 @@ func (client *api_client) send_request(method string, path string, data string)
 		resp.Body.Close()
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		body := strings.TrimPrefix(string(bodyBytes), client.xssi_prefix)
 
-		if resp.StatusCode == 301 || resp.StatusCode == 302 {
-			//Redirecting... decrement num_redirects and proceed to the next loop
-			//uri = URI.parse(rsp['Location'])
-		} else if resp.StatusCode == 404 || resp.StatusCode < 200 || resp.StatusCode >= 303 {
-			return "", errors.New(fmt.Sprintf("Unexpected response code '%d': %s", resp.StatusCode, body))
+		if resp.StatusCode == http.StatusUnauthorized && client.login != nil && login_generation > 0 {
+			/* The session probably expired. Log in again and repeat
+			   the request once; this does not count as a redirect */
+			log.Printf("api_client.go: Got 401 from %s. Logging in again...\n", req.URL)
+			session, _, err = client.relogin(login_generation)
+			if err != nil {
+				return nil, err
+			}
+			login_generation = 0
+			client.apply_login(req, session)
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+			num_redirects++
+		} else if is_redirect(resp.StatusCode) {
+			//Redirecting... build the next request and proceed to the next loop
+			if num_redirects == 0 {
+				break
+			}
+			req, err = client.redirect_request(req, resp, data, session)
+			if err != nil {
+				return nil, err
+			}
+		} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, &api_error{
+				status_code: resp.StatusCode,
+				method:      req.Method,
+				url:         req.URL.String(),
+				headers:     resp.Header,
+				body:        body,
+			}
 		} else {
 			if client.debug {
 				log.Printf("api_client.go: BODY:\n%s\n", body)
 			}
-			return body, nil
+			return &api_response{
+				status_code: resp.StatusCode,
+				headers:     resp.Header,
+				body:        body,
+				url:         req.URL,
+			}, nil
 		}
 
 	} //End loop through redirect attempts
 
-	return "", errors.New("Error - too many redirects!")
+	return nil, errors.New("Error - too many redirects!")
+}
+
+/* Build the TLS settings of the transport from the client options:
+   optionally disable verification, trust an extra CA bundle,
+   present a client certificate and pin the TLS version/server name */
+func build_tls_config(opt *apiClientOpt) (*tls.Config, error) {
+	tls_config := &tls.Config{
+		InsecureSkipVerify: opt.insecure,
+		ServerName:         opt.tls_server_name,
+	}
+
+	switch opt.tls_min_version {
+	case "":
+	case "1.0":
+		tls_config.MinVersion = tls.VersionTLS10
+	case "1.1":
+		tls_config.MinVersion = tls.VersionTLS11
+	case "1.2":
+		tls_config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tls_config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("Invalid tls_min_version '%s'. Must be one of 1.0, 1.1, 1.2 or 1.3", opt.tls_min_version)
+	}
+
+	if opt.ca_cert_file != "" || opt.ca_cert_pem != "" {
+		/* Trust the system roots as well as the provided CA */
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		ca_pem := []byte(opt.ca_cert_pem)
+		if opt.ca_cert_file != "" {
+			b, err := ioutil.ReadFile(opt.ca_cert_file)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read ca_cert_file '%s': %s", opt.ca_cert_file, err)
+			}
+			ca_pem = append(append(ca_pem, '\n'), b...)
+		}
+
+		if !pool.AppendCertsFromPEM(ca_pem) {
+			return nil, errors.New("No valid PEM certificates found in ca_cert_file/ca_cert_pem")
+		}
+		tls_config.RootCAs = pool
+	}
+
+	cert_pem := []byte(opt.client_cert_pem)
+	if opt.client_cert_file != "" {
+		b, err := ioutil.ReadFile(opt.client_cert_file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read client_cert_file '%s': %s", opt.client_cert_file, err)
+		}
+		cert_pem = b
+	}
+	key_pem := []byte(opt.client_key_pem)
+	if opt.client_key_file != "" {
+		b, err := ioutil.ReadFile(opt.client_key_file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read client_key_file '%s': %s", opt.client_key_file, err)
+		}
+		key_pem = b
+	}
+
+	if len(cert_pem) > 0 || len(key_pem) > 0 {
+		if len(cert_pem) == 0 || len(key_pem) == 0 {
+			return nil, errors.New("A client certificate and its key must be set together")
+		}
+		cert, err := tls.X509KeyPair(cert_pem, key_pem)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load the client certificate: %s", err)
+		}
+		tls_config.Certificates = []tls.Certificate{cert}
+	}
+
+	return tls_config, nil
+}
+
+/* Send a single request, retrying transport errors and the
+   configured retry_status_codes up to retry_max times. The
+   caller owns the body of the response that is returned */
+func (client *api_client) do_request(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		client.rate_limiter.wait()
+		release := client.acquire_slot()
+		resp, err := client.http_client.Do(req)
+		if err != nil {
+			release()
+		} else {
+			resp.Body = &release_on_close{ReadCloser: resp.Body, release: release}
+		}
+
+		if attempt >= client.retry_max || !client.should_retry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := client.retry_wait(attempt, resp)
+		if err != nil {
+			log.Printf("api_client.go: %s %s failed (%s). Retrying in %s (attempt %d of %d)\n", req.Method, req.URL, err, wait, attempt+1, client.retry_max)
+		} else {
+			log.Printf("api_client.go: %s %s returned %d. Retrying in %s (attempt %d of %d)\n", req.Method, req.URL, resp.StatusCode, wait, attempt+1, client.retry_max)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(wait)
+
+		/* The body was consumed by the previous attempt */
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+/* Take one of the max_concurrent_requests slots. The returned
+   function gives it back and may be called more than once */
+func (client *api_client) acquire_slot() func() {
+	if client.in_flight == nil {
+		return func() {}
+	}
+	client.in_flight <- struct{}{}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-client.in_flight })
+	}
+}
+
+/* A response body that gives back its max_concurrent_requests slot
+   once it is closed, so a request counts as in flight until its
+   response is read but not while waiting to retry it */
+type release_on_close struct {
+	io.ReadCloser
+	release func()
+}
+
+func (body *release_on_close) Close() error {
+	err := body.ReadCloser.Close()
+	body.release()
+	return err
+}
+
+func (client *api_client) should_retry(req *http.Request, resp *http.Response, err error) bool {
+	/* POST and PATCH may have been (partially) applied by the server
+	   before the failure, so only repeat them if asked to */
+	if !client.retry_non_idempotent && (req.Method == "POST" || req.Method == "PATCH") {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	for _, code := range client.retry_status_codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+/* Exponential backoff from retry_backoff_base capped at retry_backoff_max.
+   A Retry-After header from the server (seconds or HTTP-date) wins */
+func (client *api_client) retry_wait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parse_retry_after(resp.Header.Get("Retry-After")); ok {
+			/* Don't let the server hold an apply for hours */
+			if wait > client.retry_backoff_max {
+				wait = client.retry_backoff_max
+			}
+			return wait
+		}
+	}
+
+	wait := client.retry_backoff_base
+	for i := 0; i < attempt && wait < client.retry_backoff_max; i++ {
+		wait *= 2
+	}
+	if wait > client.retry_backoff_max {
+		wait = client.retry_backoff_max
+	}
+
+	if client.retry_jitter && wait > 1 {
+		/* Keep at least half of the wait so retries still back off */
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+	return wait
+}
+
+func parse_retry_after(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Second * time.Duration(seconds), true
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		wait := time.Until(when)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+func is_redirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+/* Build the request to send after receiving a redirect response.
+   303 always becomes a GET without a body, 301/302 turn a POST
+   into a GET (as browsers and curl do) and 307/308 replay the
+   original method and body. */
+func (client *api_client) redirect_request(req *http.Request, resp *http.Response, data string, session string) (*http.Request, error) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, fmt.Errorf("Received redirect response code '%d' from %s without a Location header", resp.StatusCode, req.URL)
+	}
+
+	next_url, err := req.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse Location header '%s' of redirect from %s: %s", location, req.URL, err)
+	}
+
+	/* Refuse to hand our credentials to some other host unless told otherwise */
+	if !client.allow_cross_host_redirects && req.Header.Get("Authorization") != "" && !same_host(req.URL, next_url) {
+		return nil, fmt.Errorf("Refusing to follow redirect from %s to %s: the request carries an Authorization header and allow_cross_host_redirects is not set", req.URL, next_url)
+	}
+
+	method := req.Method
+	switch resp.StatusCode {
+	case http.StatusSeeOther:
+		if method != "HEAD" {
+			method = "GET"
+		}
+	case http.StatusMovedPermanently, http.StatusFound:
+		if method == "POST" {
+			method = "GET"
+		}
+	}
+
+	var next_req *http.Request
+	if method == "GET" || method == "HEAD" || data == "" {
+		next_req, err = http.NewRequest(method, next_url.String(), nil)
+	} else {
+		next_req, err = http.NewRequest(method, next_url.String(), bytes.NewBuffer([]byte(data)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range req.Header {
+		next_req.Header[name] = values
+	}
+
+	/* The cookie jar adds the cookies of the next host when sending.
+	   Copying the ones it added to this request would send them twice,
+	   or to a host they do not belong to */
+	next_req.Header.Del("Cookie")
+	if !client.allow_cross_host_redirects && !same_host(req.URL, next_url) {
+		/* Like net/http, keep the login session off other hosts */
+		if client.login != nil && client.login.header_name != "" {
+			next_req.Header.Del(client.login.header_name)
+		}
+	} else {
+		/* Put back the cookies that did not come from the jar */
+		for n, v := range client.headers {
+			if strings.EqualFold(n, "Cookie") {
+				next_req.Header.Set(n, v)
+			}
+		}
+		if client.login != nil && session != "" {
+			client.apply_login(next_req, session)
+		}
+	}
+
+	if next_req.Body == nil {
+		next_req.Header.Del("Content-Type")
+	}
+
+	if client.debug {
+		log.Printf("api_client.go: Following %d redirect: %s %s\n", resp.StatusCode, method, next_url)
+	}
+	return next_req, nil
+}
+
+/* Compare hosts the way a browser would for credentials:
+   scheme, hostname and port must all match */
+func same_host(a *url.URL, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Host, b.Host)
 }
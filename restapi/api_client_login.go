@@ -0,0 +1,168 @@
+package restapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+/* Settings for APIs that require a call to a login endpoint
+   before anything else. The token found in the login response
+   is sent with every later request until the API answers 401 */
+type loginOpt struct {
+	path         string
+	method       string
+	body         string
+	token_key    string
+	token_header string
+	header_name  string
+	header_value string
+	cookie_name  string
+}
+
+func validate_login_opt(opt *loginOpt, use_cookies bool) error {
+	if opt.path == "" {
+		return errors.New("login requires a path")
+	}
+	if opt.method == "" {
+		opt.method = "POST"
+	}
+	if opt.token_key != "" && opt.token_header != "" {
+		return errors.New("login: only one of token_key and token_header may be set")
+	}
+	if opt.token_key == "" && opt.token_header == "" {
+		/* Nothing to extract, so the session must live in a cookie */
+		if !use_cookies {
+			return errors.New("login: one of token_key or token_header must be set unless use_cookies is enabled to keep the session cookie")
+		}
+		return nil
+	}
+	if opt.cookie_name == "" {
+		if opt.header_name == "" {
+			opt.header_name = "Authorization"
+		}
+		if opt.header_value == "" {
+			opt.header_value = "Bearer {token}"
+		}
+	}
+	return nil
+}
+
+/* Return the current session token, logging in first if needed.
+   The generation identifies the session so a request that gets a
+   401 can ask for a new one without every concurrent caller
+   logging in again */
+func (client *api_client) login_token() (string, int, error) {
+	client.login_mutex.Lock()
+	defer client.login_mutex.Unlock()
+
+	if client.login_generation == 0 {
+		if err := client.do_login(); err != nil {
+			return "", 0, err
+		}
+	}
+	return client.login_session, client.login_generation, nil
+}
+
+/* Log in again unless another request already did so after
+   the session identified by generation was handed out */
+func (client *api_client) relogin(generation int) (string, int, error) {
+	client.login_mutex.Lock()
+	defer client.login_mutex.Unlock()
+
+	if client.login_generation == generation {
+		if err := client.do_login(); err != nil {
+			return "", 0, err
+		}
+	}
+	return client.login_session, client.login_generation, nil
+}
+
+/* Must be called with login_mutex held */
+func (client *api_client) do_login() error {
+	opt := client.login
+	full_uri := client.uri + opt.path
+
+	if client.debug {
+		log.Printf("api_client_login.go: Logging in with %s %s\n", opt.method, full_uri)
+	}
+
+	var req *http.Request
+	var err error
+	if opt.body == "" {
+		req, err = http.NewRequest(opt.method, full_uri, nil)
+	} else {
+		req, err = http.NewRequest(opt.method, full_uri, bytes.NewBuffer([]byte(opt.body)))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for n, v := range client.headers {
+		req.Header.Set(n, v)
+	}
+
+	resp, err := client.do_request(req)
+	if err != nil {
+		return fmt.Errorf("Login to '%s' failed: %s", full_uri, err)
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body := strings.TrimPrefix(string(bodyBytes), client.xssi_prefix)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Login to '%s' failed with response code '%d': %s", full_uri, resp.StatusCode, body)
+	}
+
+	session := ""
+	if opt.token_header != "" {
+		session = resp.Header.Get(opt.token_header)
+		if session == "" {
+			return fmt.Errorf("Login response from '%s' does not have the '%s' header", full_uri, opt.token_header)
+		}
+	} else if opt.token_key != "" {
+		var data map[string]interface{}
+		if err := json_decode(body, &data); err != nil {
+			return fmt.Errorf("Login response from '%s' is not a JSON object: %s", full_uri, err)
+		}
+		session, err = GetStringAtKey(data, opt.token_key, client.debug)
+		if err != nil {
+			return fmt.Errorf("Failed to find the token at '%s' in the login response: %s", opt.token_key, err)
+		}
+	}
+
+	client.login_session = session
+	client.login_generation++
+
+	if client.debug {
+		log.Printf("api_client_login.go: Logged in (session %d)\n", client.login_generation)
+	}
+	return nil
+}
+
+/* Put the session token on a request as configured. Cookie-only
+   sessions are carried by the cookie jar and need nothing here */
+func (client *api_client) apply_login(req *http.Request, session string) {
+	opt := client.login
+	if opt.token_key == "" && opt.token_header == "" {
+		return
+	}
+
+	if opt.cookie_name != "" {
+		/* The cookie jar adds its own cookies again when sending */
+		req.Header.Del("Cookie")
+		req.AddCookie(&http.Cookie{Name: opt.cookie_name, Value: session})
+	} else {
+		req.Header.Set(opt.header_name, strings.Replace(opt.header_value, "{token}", session, -1))
+	}
+}
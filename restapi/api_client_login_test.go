@@ -0,0 +1,143 @@
+package restapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAPIClientLogin(t *testing.T) {
+	var logins int32
+	var expired int32
+
+	/* Another host to redirect to. Cookies do not care about ports,
+	   so it is reached as localhost rather than 127.0.0.1 */
+	_, other_svr := new_test_client(t, map[string]http.HandlerFunc{
+		"/headers": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s|%s", strings.Join(r.Header["Cookie"], ";"), r.Header.Get("X-Auth"))
+		},
+	}, nil)
+	defer other_svr.Close()
+	other_url := strings.Replace(other_svr.URL, "127.0.0.1", "localhost", 1)
+
+	client, svr := new_test_client(t, map[string]http.HandlerFunc{
+		"/headers": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s|%s", strings.Join(r.Header["Cookie"], ";"), r.Header.Get("X-Auth"))
+		},
+		"/same_host": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/headers", http.StatusFound)
+		},
+		"/other_host": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, other_url+"/headers", http.StatusFound)
+		},
+		"/login": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{ "session": { "token": "t%d" } }`, atomic.AddInt32(&logins, 1))
+		},
+		"/session_cookie": func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "from_cookie"})
+		},
+		"/ok": func(w http.ResponseWriter, r *http.Request) {
+			if atomic.CompareAndSwapInt32(&expired, 1, 0) {
+				http.Error(w, "Session expired", http.StatusUnauthorized)
+				return
+			}
+			if cookie, err := r.Cookie("session"); err == nil {
+				w.Write([]byte(cookie.Value))
+				return
+			}
+			w.Write([]byte(r.Header.Get("X-Auth")))
+		},
+	}, &apiClientOpt{
+		login: &loginOpt{
+			path:         "/login",
+			body:         `{ "username": "foo", "password": "bar" }`,
+			token_key:    "session/token",
+			header_name:  "X-Auth",
+			header_value: "Token {token}",
+		},
+	})
+	defer svr.Close()
+
+	t.Run("token_header", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			res, err := client.send_request("GET", "/ok", "")
+			if err != nil {
+				t.Fatalf("api_client_login_test.go: %s", err)
+			}
+			if res != "Token t1" || atomic.LoadInt32(&logins) != 1 {
+				t.Fatalf("api_client_login_test.go: Got back '%s' after %d logins but expected 'Token t1' after 1", res, atomic.LoadInt32(&logins))
+			}
+		}
+	})
+
+	/* A 401 means log in again and repeat the request */
+	t.Run("expired_session", func(t *testing.T) {
+		atomic.StoreInt32(&expired, 1)
+		res, err := client.send_request("GET", "/ok", "")
+		if err != nil {
+			t.Fatalf("api_client_login_test.go: %s", err)
+		}
+		if res != "Token t2" || atomic.LoadInt32(&logins) != 2 {
+			t.Fatalf("api_client_login_test.go: Got back '%s' after %d logins but expected 'Token t2' after 2", res, atomic.LoadInt32(&logins))
+		}
+	})
+
+	/* The session goes along on redirects, but not to other hosts */
+	t.Run("redirects", func(t *testing.T) {
+		tests := map[string]string{
+			"/same_host":  "|Token t2",
+			"/other_host": "|",
+		}
+		for path, expected := range tests {
+			res, err := client.send_request("GET", path, "")
+			if err != nil {
+				t.Fatalf("api_client_login_test.go: %s", err)
+			}
+			if res != expected {
+				t.Errorf("api_client_login_test.go: Got back '%s' from '%s' but expected '%s'", res, path, expected)
+			}
+		}
+	})
+
+	/* Sessions kept only in a cookie need the cookie jar */
+	t.Run("session_cookie", func(t *testing.T) {
+		opt := &apiClientOpt{
+			uri:     svr.URL,
+			timeout: 2,
+			login:   &loginOpt{path: "/session_cookie"},
+		}
+		if _, err := NewAPIClient(opt); err == nil {
+			t.Fatalf("api_client_login_test.go: Cookie session without use_cookies was accepted")
+		}
+		opt.use_cookies = true
+		cookie_client, err := NewAPIClient(opt)
+		if err != nil {
+			t.Fatalf("api_client_login_test.go: %s", err)
+		}
+		res, err := cookie_client.send_request("GET", "/ok", "")
+		if err != nil {
+			t.Fatalf("api_client_login_test.go: %s", err)
+		}
+		if res != "from_cookie" {
+			t.Fatalf("api_client_login_test.go: Got back '%s' but expected 'from_cookie'", res)
+		}
+
+		/* The jar adds the cookie on each hop, so it must not be copied
+		   along, and it must not reach another host */
+		tests := map[string]string{
+			"/same_host":  "session=from_cookie|",
+			"/other_host": "|",
+		}
+		for path, expected := range tests {
+			res, err := cookie_client.send_request("GET", path, "")
+			if err != nil {
+				t.Fatalf("api_client_login_test.go: %s", err)
+			}
+			if res != expected {
+				t.Errorf("api_client_login_test.go: Got back '%s' from '%s' but expected '%s'", res, path, expected)
+			}
+		}
+	})
+}
@@ -1,13 +1,27 @@
 package restapi
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
 	"log"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 var api_client_server *http.Server
+/* Counted with sync/atomic as the handlers run on the server goroutines */
+var flaky_requests int32
+var token_requests int32
 
 func TestAPIClient(t *testing.T) {
 	debug := false
@@ -31,6 +45,7 @@ func TestAPIClient(t *testing.T) {
 		create_returns_object: false,
 		debug:                 debug,
 	}
+	/* max_redirects is not set, so redirects are followed by default */
 	client, err := NewAPIClient(opt)
 
 	var res string
@@ -57,6 +72,129 @@ func TestAPIClient(t *testing.T) {
 		t.Fatalf("client_test.go: Got back '%s' but expected 'It works!'\n", res)
 	}
 
+	if debug {
+		log.Printf("api_client_test.go: Testing errors carry the response details\n")
+	}
+	_, err = client.send_request("GET", "/missing", "")
+	if api_err, ok := err.(*api_error); !ok {
+		t.Fatalf("client_test.go: Expected an *api_error for a missing path but got '%v'", err)
+	} else if api_err.status_code != 404 || api_err.method != "GET" || api_err.url != "http://127.0.0.1:8080/missing" {
+		t.Fatalf("client_test.go: Unexpected api_error for a missing path: %+v", api_err)
+	}
+	if !is_api_error_status(err, 404) || is_api_error_status(err, 500) {
+		t.Fatalf("client_test.go: is_api_error_status did not match the 404")
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing 303 redirect turns a POST into a GET\n")
+	}
+	res, err = client.send_request("POST", "/see_other", `{ "id": "1" }`)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	if res != "GET " {
+		t.Fatalf("client_test.go: Got back '%s' but expected 'GET '\n", res)
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing 307 redirect replays method and body\n")
+	}
+	res, err = client.send_request("POST", "/temporary", `{ "id": "1" }`)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	if res != `POST { "id": "1" }` {
+		t.Fatalf("client_test.go: Got back '%s' but expected 'POST { \"id\": \"1\" }'\n", res)
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing redirect loops are bounded by max_redirects\n")
+	}
+	_, err = client.send_request("GET", "/loop", "")
+	if err == nil {
+		t.Fatalf("client_test.go: Redirect loop did not produce an error")
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing a negative max_redirects follows no redirects\n")
+	}
+	no_redirects_opt := *opt
+	no_redirects_opt.max_redirects = -1
+	no_redirects_client, _ := NewAPIClient(&no_redirects_opt)
+	_, err = no_redirects_client.send_request("GET", "/redirect", "")
+	if err == nil {
+		t.Fatalf("client_test.go: Redirect was followed with a negative max_redirects")
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing cross host redirects do not leak Authorization\n")
+	}
+	opt.headers = map[string]string{"Authorization": "Bearer secret"}
+	auth_client, _ := NewAPIClient(opt)
+	_, err = auth_client.send_request("GET", "/cross_host", "")
+	if err == nil {
+		t.Fatalf("client_test.go: Cross host redirect with an Authorization header was followed")
+	}
+	opt.allow_cross_host_redirects = true
+	auth_client, _ = NewAPIClient(opt)
+	res, err = auth_client.send_request("GET", "/cross_host", "")
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	if res != "It works!" {
+		t.Fatalf("client_test.go: Got back '%s' but expected 'It works!'\n", res)
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing retries of throttled requests\n")
+	}
+	opt.headers = make(map[string]string, 0)
+	opt.retry_max = 2
+	opt.retry_backoff_base_ms = 10
+	retry_client, _ := NewAPIClient(opt)
+	atomic.StoreInt32(&flaky_requests, 0)
+	res, err = retry_client.send_request("GET", "/flaky", "")
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	if n := atomic.LoadInt32(&flaky_requests); res != "It works!" || n != 3 {
+		t.Fatalf("client_test.go: Got back '%s' after %d requests but expected 'It works!' after 3\n", res, n)
+	}
+
+	atomic.StoreInt32(&flaky_requests, 0)
+	_, err = retry_client.send_request("POST", "/flaky", `{ "id": "1" }`)
+	if n := atomic.LoadInt32(&flaky_requests); err == nil || n != 1 {
+		t.Fatalf("client_test.go: POST was retried (%d requests) without retry_non_idempotent", n)
+	}
+
+	if debug {
+		log.Printf("api_client_test.go: Testing OAuth2 client credentials\n")
+	}
+	opt.retry_max = 0
+	opt.oauth_client_id = "terraform"
+	opt.oauth_client_secret = "s3cr3t"
+	opt.oauth_token_endpoint = "http://127.0.0.1:8080/token"
+	oauth_client, _ := NewAPIClient(opt)
+	atomic.StoreInt32(&token_requests, 0)
+	for i := 0; i < 3; i++ {
+		res, err = oauth_client.send_request("GET", "/protected", "")
+		if err != nil {
+			t.Fatalf("client_test.go: %s", err)
+		}
+	}
+	if n := atomic.LoadInt32(&token_requests); res != "It works!" || n != 1 {
+		t.Fatalf("client_test.go: Got back '%s' after %d token requests but expected 'It works!' after 1\n", res, n)
+	}
+	opt.oauth_client_id = ""
+
+	if debug {
+		log.Printf("api_client_test.go: Testing an invalid method is an error\n")
+	}
+	_, err = client.send_request("PO ST", "/ok", "")
+	if err == nil {
+		t.Fatalf("client_test.go: Request with an invalid method did not produce an error")
+	}
+
 	/* Verify timeout works */
 	if debug {
 		log.Printf("api_client_test.go: Testing timeout aborts requests\n")
@@ -75,6 +213,108 @@ func TestAPIClient(t *testing.T) {
 	}
 }
 
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parse_retry_after("3"); !ok || wait != 3*time.Second {
+		t.Fatalf("client_test.go: Expected 3s from Retry-After '3' but got %s", wait)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if wait, ok := parse_retry_after(date); !ok || wait < 59*time.Minute || wait > time.Hour {
+		t.Fatalf("client_test.go: Expected about an hour from Retry-After '%s' but got %s", date, wait)
+	}
+
+	if _, ok := parse_retry_after("soon"); ok {
+		t.Fatalf("client_test.go: Retry-After 'soon' should not parse")
+	}
+
+	client, _ := NewAPIClient(&apiClientOpt{uri: "http://127.0.0.1:8080", retry_backoff_max_ms: 1000})
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"86400"}}}
+	if wait := client.retry_wait(0, resp); wait != time.Second {
+		t.Fatalf("client_test.go: Expected Retry-After '86400' to be capped at 1s by retry_backoff_max_ms but got %s", wait)
+	}
+}
+
+func TestAPIClientTLS(t *testing.T) {
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "No client certificate", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("Hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	svr.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	svr.StartTLS()
+	defer svr.Close()
+
+	ca_pem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+	cert_pem, key_pem := generate_client_cert(t, "terraform")
+
+	opt := &apiClientOpt{
+		uri:             svr.URL,
+		headers:         make(map[string]string, 0),
+		timeout:         2,
+		ca_cert_pem:     string(ca_pem),
+		client_cert_pem: string(cert_pem),
+		client_key_pem:  string(key_pem),
+		tls_min_version: "1.2",
+	}
+	client, err := NewAPIClient(opt)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+
+	res, err := client.send_request("GET", "/", "")
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	if res != "Hello terraform" {
+		t.Fatalf("client_test.go: Got back '%s' but expected 'Hello terraform'\n", res)
+	}
+
+	/* Without the CA, the server certificate is not trusted */
+	opt.ca_cert_pem = ""
+	client, _ = NewAPIClient(opt)
+	if _, err = client.send_request("GET", "/", ""); err == nil {
+		t.Fatalf("client_test.go: Request succeeded without trusting the server's CA")
+	}
+
+	opt.tls_min_version = "1.9"
+	if _, err = NewAPIClient(opt); err == nil {
+		t.Fatalf("client_test.go: Invalid tls_min_version was accepted")
+	}
+
+	opt.tls_min_version = ""
+	opt.client_key_pem = ""
+	if _, err = NewAPIClient(opt); err == nil {
+		t.Fatalf("client_test.go: Client certificate without a key was accepted")
+	}
+}
+
+func generate_client_cert(t *testing.T, name string) (cert_pem []byte, key_pem []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	key_der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("client_test.go: %s", err)
+	}
+	cert_pem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key_pem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der})
+	return cert_pem, key_pem
+}
+
 func setup_api_client_server() {
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
@@ -87,6 +327,46 @@ func setup_api_client_server() {
 	serverMux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/ok", http.StatusPermanentRedirect)
 	})
+	serverMux.HandleFunc("/see_other", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusSeeOther)
+	})
+	serverMux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+	})
+	serverMux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	serverMux.HandleFunc("/cross_host", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:8080/ok", http.StatusFound)
+	})
+	serverMux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flaky_requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "Slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("It works!"))
+	})
+	serverMux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&token_requests, 1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "terraform" || secret != "s3cr3t" {
+			http.Error(w, "Bad client credentials", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{ "access_token": "t0k3n", "token_type": "bearer", "expires_in": 3600 }`))
+	})
+	serverMux.HandleFunc("/protected", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			http.Error(w, "Missing token", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("It works!"))
+	})
+	serverMux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(b)))
+	})
 
 	api_client_server = &http.Server{
 		Addr:    "127.0.0.1:8080",
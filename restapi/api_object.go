@@ -7,7 +7,11 @@ import (
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"log"
+	"net/http"
+	"net/url"
+	"path"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -16,6 +20,8 @@ type apiObjectOpts struct {
 	get_path        string
 	post_path       string
 	create_with_put bool
+	upsert          bool
+	on_conflict     string
 	put_path        string
 	delete_path     string
 	search_path     string
@@ -23,6 +29,52 @@ type apiObjectOpts struct {
 	id              string
 	id_attribute    string
 	data            string
+
+	conflict_search_key  string
+	conflict_results_key string
+
+	response_object_key string
+	request_wrapper_key string
+
+	create_id_header string
+	create_id_path   string
+
+	create_method  string
+	read_method    string
+	update_method  string
+	destroy_method string
+
+	update_body_format string
+	previous_data      string
+
+	headers              map[string]string
+	create_headers       map[string]string
+	read_headers         map[string]string
+	update_headers       map[string]string
+	destroy_headers      map[string]string
+	path_variables       map[string]string
+	api_data             map[string]string
+	query_params         map[string]string
+	create_query_params  map[string]string
+	read_query_params    map[string]string
+	update_query_params  map[string]string
+	destroy_query_params map[string]string
+
+	poll        *pollOpt
+	operation   *operationOpt
+	read_search *readSearchOpt
+
+	not_found_status_codes []int
+	not_found_body_regex   string
+}
+
+/* How to read an object by searching search_path, for APIs
+   that only list objects. search_value may contain {id} */
+type readSearchOpt struct {
+	search_key   string
+	search_value string
+	results_key  string
+	query_string string
 }
 
 type api_object struct {
@@ -30,16 +82,68 @@ type api_object struct {
 	get_path        string
 	post_path       string
 	create_with_put bool
+	upsert          bool /* Update instead of create objects that already exist */
 	put_path        string
 	delete_path     string
 	search_path     string
 	debug           bool
 	id              string
 	id_attribute    string
+	created         bool /* The server accepted the create, so the object exists even if create_object failed later */
+
+	/* Envelopes around the object in responses and requests */
+	response_object_key string
+	request_wrapper_key string
+
+	/* What to do when a create answers 409 Conflict: fail, adopt
+	   or adopt_and_update, and how to search for the existing object */
+	on_conflict          string
+	conflict_search_key  string
+	conflict_results_key string
+
+	/* Where to find the id of a created object in the response */
+	create_id_header string
+	create_id_path   string
+
+	/* HTTP methods used for each operation */
+	create_method  string
+	read_method    string
+	update_method  string
+	destroy_method string
+
+	/* How to send updates: full, merge_patch or json_patch */
+	update_body_format string
+
+	/* Headers and query parameters for each operation. Headers
+	   are sent over the client-wide headers */
+	create_headers       map[string]string
+	read_headers         map[string]string
+	update_headers       map[string]string
+	destroy_headers      map[string]string
+	create_query_params  map[string]string
+	read_query_params    map[string]string
+	update_query_params  map[string]string
+	destroy_query_params map[string]string
+
+	/* Values for the {name} placeholders in paths */
+	path_variables map[string]string
+
+	/* Wait for asynchronous operations to finish */
+	poll      *pollOpt
+	operation *operationOpt
+
+	/* Read by searching instead of from get_path */
+	read_search *readSearchOpt
+
+	/* What the API answers for objects that no longer exist */
+	not_found_status_codes []int
+	not_found_body_regex   *regexp.Regexp
 
 	/* Set internally */
-	data     map[string]interface{} /* Data as managed by the user */
-	api_data map[string]interface{} /* Data as available from the API */
+	data          map[string]interface{} /* Data as managed by the user */
+	api_data      map[string]interface{} /* Data as available from the API */
+	api_response  string                 /* The raw JSON the API data was read from */
+	previous_data map[string]interface{} /* Data as managed by the user before this change */
 }
 
 // Make an api_object to manage a RESTful object in an API
@@ -57,6 +161,13 @@ func NewAPIObject(i_client *api_client, opts *apiObjectOpts) (*api_object, error
 		opts.id_attribute = i_client.id_attribute
 	}
 
+	if opts.response_object_key == "" {
+		opts.response_object_key = i_client.response_object_key
+	}
+	if opts.request_wrapper_key == "" {
+		opts.request_wrapper_key = i_client.request_wrapper_key
+	}
+
 	if opts.post_path == "" {
 		opts.post_path = opts.path
 	}
@@ -73,19 +184,128 @@ func NewAPIObject(i_client *api_client, opts *apiObjectOpts) (*api_object, error
 		opts.search_path = opts.path
 	}
 
+	/* Methods set on the object win over create_with_put,
+	   which in turn wins over the client-wide defaults */
+	if opts.create_method == "" {
+		if opts.create_with_put {
+			opts.create_method = "PUT"
+		} else {
+			opts.create_method = i_client.create_method
+		}
+	}
+	if opts.read_method == "" {
+		opts.read_method = i_client.read_method
+	}
+	if opts.update_method == "" {
+		opts.update_method = i_client.update_method
+	}
+	if opts.destroy_method == "" {
+		opts.destroy_method = i_client.destroy_method
+	}
+
+	switch opts.update_body_format {
+	case "":
+		opts.update_body_format = "full"
+	case "full", "merge_patch", "json_patch":
+	default:
+		return nil, fmt.Errorf("Invalid update_body_format '%s'. Must be one of full, merge_patch or json_patch", opts.update_body_format)
+	}
+
+	switch opts.on_conflict {
+	case "":
+		opts.on_conflict = "fail"
+	case "fail", "adopt", "adopt_and_update":
+	default:
+		return nil, fmt.Errorf("Invalid on_conflict '%s'. Must be one of fail, adopt or adopt_and_update", opts.on_conflict)
+	}
+
+	if opts.poll != nil {
+		if err := validate_poll_opt(opts.poll); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.operation != nil {
+		if err := validate_operation_opt(opts.operation); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.read_search != nil {
+		if opts.read_search.search_key == "" {
+			return nil, errors.New("read_search requires a search_key")
+		}
+		if opts.read_search.search_value == "" {
+			opts.read_search.search_value = "{id}"
+		}
+	}
+
+	if len(opts.not_found_status_codes) == 0 {
+		opts.not_found_status_codes = []int{http.StatusNotFound}
+	}
+
+	var not_found_body_regex *regexp.Regexp
+	if opts.not_found_body_regex != "" {
+		var err error
+		not_found_body_regex, err = regexp.Compile(opts.not_found_body_regex)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid not_found_body_regex '%s': %s", opts.not_found_body_regex, err)
+		}
+	}
+
 	obj := api_object{
-		api_client:      i_client,
-		get_path:        opts.get_path,
-		post_path:       opts.post_path,
-		create_with_put: opts.create_with_put,
-		put_path:        opts.put_path,
-		delete_path:     opts.delete_path,
-		search_path:     opts.search_path,
-		debug:           opts.debug,
-		id:              opts.id,
-		id_attribute:    opts.id_attribute,
-		data:            make(map[string]interface{}),
-		api_data:        make(map[string]interface{}),
+		api_client:             i_client,
+		get_path:               opts.get_path,
+		post_path:              opts.post_path,
+		create_with_put:        opts.create_with_put,
+		upsert:                 opts.upsert,
+		on_conflict:            opts.on_conflict,
+		conflict_search_key:    opts.conflict_search_key,
+		conflict_results_key:   opts.conflict_results_key,
+		put_path:               opts.put_path,
+		delete_path:            opts.delete_path,
+		search_path:            opts.search_path,
+		debug:                  opts.debug,
+		id:                     opts.id,
+		id_attribute:           opts.id_attribute,
+		response_object_key:    opts.response_object_key,
+		request_wrapper_key:    opts.request_wrapper_key,
+		create_id_header:       opts.create_id_header,
+		create_id_path:         opts.create_id_path,
+		create_method:          opts.create_method,
+		read_method:            opts.read_method,
+		update_method:          opts.update_method,
+		destroy_method:         opts.destroy_method,
+		update_body_format:     opts.update_body_format,
+		create_headers:         merge_string_maps(opts.headers, opts.create_headers),
+		read_headers:           merge_string_maps(opts.headers, opts.read_headers),
+		update_headers:         merge_string_maps(opts.headers, opts.update_headers),
+		destroy_headers:        merge_string_maps(opts.headers, opts.destroy_headers),
+		create_query_params:    merge_string_maps(opts.query_params, opts.create_query_params),
+		read_query_params:      merge_string_maps(opts.query_params, opts.read_query_params),
+		update_query_params:    merge_string_maps(opts.query_params, opts.update_query_params),
+		destroy_query_params:   merge_string_maps(opts.query_params, opts.destroy_query_params),
+		poll:                   opts.poll,
+		operation:              opts.operation,
+		read_search:            opts.read_search,
+		not_found_status_codes: opts.not_found_status_codes,
+		not_found_body_regex:   not_found_body_regex,
+		path_variables:         opts.path_variables,
+		data:                   make(map[string]interface{}),
+		api_data:               make(map[string]interface{}),
+		previous_data:          make(map[string]interface{}),
+	}
+
+	/* api_data as last known (such as from the state) so
+	   it can be used in paths before the object is read */
+	for k, v := range opts.api_data {
+		obj.api_data[k] = v
+	}
+
+	if opts.previous_data != "" {
+		if err := json_decode(opts.previous_data, &obj.previous_data); err != nil {
+			return nil, err
+		}
 	}
 
 	if opts.data != "" {
@@ -93,7 +313,7 @@ func NewAPIObject(i_client *api_client, opts *apiObjectOpts) (*api_object, error
 			log.Printf("api_object.go: Parsing data: '%s'", opts.data)
 		}
 
-		err := json.Unmarshal([]byte(opts.data), &obj.data)
+		err := json_decode(opts.data, &obj.data)
 		if err != nil {
 			return nil, err
 		}
@@ -127,10 +347,19 @@ func NewAPIObject(i_client *api_client, opts *apiObjectOpts) (*api_object, error
 func (obj *api_object) toString() string {
 	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf("id: %s\n", obj.id))
-	buffer.WriteString(fmt.Sprintf("get_path: %s\n", obj.get_path))
-	buffer.WriteString(fmt.Sprintf("post_path: %s\n", obj.post_path))
-	buffer.WriteString(fmt.Sprintf("put_path: %s\n", obj.put_path))
-	buffer.WriteString(fmt.Sprintf("delete_path: %s\n", obj.delete_path))
+	buffer.WriteString(fmt.Sprintf("get_path: %s %s\n", obj.read_method, obj.get_path))
+	buffer.WriteString(fmt.Sprintf("post_path: %s %s\n", obj.create_method, obj.post_path))
+	buffer.WriteString(fmt.Sprintf("put_path: %s %s\n", obj.update_method, obj.put_path))
+	buffer.WriteString(fmt.Sprintf("delete_path: %s %s\n", obj.destroy_method, obj.delete_path))
+	buffer.WriteString(fmt.Sprintf("update_body_format: %s\n", obj.update_body_format))
+	buffer.WriteString(fmt.Sprintf("response_object_key: %s\n", obj.response_object_key))
+	buffer.WriteString(fmt.Sprintf("request_wrapper_key: %s\n", obj.request_wrapper_key))
+	buffer.WriteString(fmt.Sprintf("headers: create=%v read=%v update=%v destroy=%v\n", obj.create_headers, obj.read_headers, obj.update_headers, obj.destroy_headers))
+	buffer.WriteString(fmt.Sprintf("query_params: create=%v read=%v update=%v destroy=%v\n", obj.create_query_params, obj.read_query_params, obj.update_query_params, obj.destroy_query_params))
+	if obj.poll != nil {
+		buffer.WriteString(fmt.Sprintf("poll: %s in %v (every %s for up to %s)\n", obj.poll.status_key, obj.poll.success_values, obj.poll.interval, obj.poll.timeout))
+	}
+	buffer.WriteString(fmt.Sprintf("not_found_status_codes: %v\n", obj.not_found_status_codes))
 	buffer.WriteString(fmt.Sprintf("debug: %t\n", obj.debug))
 	buffer.WriteString(fmt.Sprintf("data: %s\n", spew.Sdump(obj.data)))
 	buffer.WriteString(fmt.Sprintf("api_data: %s\n", spew.Sdump(obj.api_data)))
@@ -145,12 +374,10 @@ func (obj *api_object) update_state(state string) error {
 		log.Printf("api_object.go: Updating API object state to '%s'\n", state)
 	}
 
-	/* Other option - Decode as JSON Numbers instead of golang datatypes
-	d := json.NewDecoder(strings.NewReader(res_str))
-	d.UseNumber()
-	err = d.Decode(&obj.api_data)
-	*/
-	err := json.Unmarshal([]byte(state), &obj.api_data)
+	/* Numbers are decoded as json.Number so large IDs are not rounded */
+	obj.api_data = make(map[string]interface{})
+	err := json_decode(state, &obj.api_data)
+	obj.api_response = state
 	if err != nil {
 		return err
 	}
@@ -185,28 +412,178 @@ func (obj *api_object) update_state(state string) error {
 	return err
 }
 
+/* Take over the object that made a create fail with a conflict.
+   It is found by its id or, without one, by searching for the
+   value of conflict_search_key in data. With adopt_and_update,
+   data is then sent to it */
+func (obj *api_object) adopt_existing_object(conflict error) error {
+	if obj.debug {
+		log.Printf("api_object.go: Create failed with a conflict (on_conflict=%s). Looking for the existing object: %s\n", obj.on_conflict, conflict)
+	}
+
+	if obj.id == "" {
+		if obj.conflict_search_key == "" {
+			return fmt.Errorf("%s. The existing object cannot be adopted because its id is not known and conflict_search_key is not set", conflict)
+		}
+		search_value, err := GetStringAtKey(obj.data, obj.conflict_search_key, obj.debug)
+		if err != nil {
+			return fmt.Errorf("%s. The existing object cannot be adopted because conflict_search_key '%s' is not in data: %s", conflict, obj.conflict_search_key, err)
+		}
+		if err := obj.find_object("", obj.conflict_search_key, search_value, obj.conflict_results_key); err != nil {
+			return fmt.Errorf("%s. The existing object could not be found to adopt it: %s", conflict, err)
+		}
+	}
+
+	if err := obj.read_object(); err != nil {
+		return err
+	}
+	obj.created = true
+	if obj.on_conflict == "adopt_and_update" {
+		return obj.update_object()
+	}
+	return nil
+}
+
+/* Same as update_state, but for a whole response in which the
+   object may be wrapped in an envelope at response_object_key */
+func (obj *api_object) update_state_from_response(body string) error {
+	state := body
+	if obj.response_object_key != "" {
+		var response map[string]interface{}
+		if err := json_decode(body, &response); err != nil {
+			return fmt.Errorf("api_object.go: The response is not a JSON object, so response_object_key '%s' cannot be found in it: %s", obj.response_object_key, err)
+		}
+		object, err := GetObjectAtKey(response, obj.response_object_key, obj.debug)
+		if err != nil {
+			return fmt.Errorf("api_object.go: Failed to find response_object_key '%s' in the response: %s", obj.response_object_key, err)
+		}
+		if _, ok := object.(map[string]interface{}); !ok {
+			return fmt.Errorf("api_object.go: The value at response_object_key '%s' is not an object. It is a '%T'", obj.response_object_key, object)
+		}
+		b, _ := json.Marshal(object)
+		state = string(b)
+	}
+
+	err := obj.update_state(state)
+	/* Keep the envelope in api_response as it may have useful metadata */
+	obj.api_response = body
+	return err
+}
+
+/* Set the id of a created object from the create_id_header (the
+   last path segment for Location) or create_id_path of the response */
+func (obj *api_object) id_from_create_response(resp *api_response) error {
+	if obj.create_id_header != "" {
+		value := resp.headers.Get(obj.create_id_header)
+		if value == "" {
+			return fmt.Errorf("api_object.go: The object may have been created, but the response does not have the '%s' header to get its id from", obj.create_id_header)
+		}
+		if strings.EqualFold(obj.create_id_header, "Location") {
+			location, err := url.Parse(value)
+			if err != nil {
+				return fmt.Errorf("api_object.go: The object may have been created, but the Location '%s' of the response cannot be parsed: %s", value, err)
+			}
+			value = path.Base(strings.TrimRight(location.Path, "/"))
+		}
+		obj.id = value
+	} else {
+		var response map[string]interface{}
+		if err := json_decode(resp.body, &response); err != nil {
+			return fmt.Errorf("api_object.go: The object may have been created, but the response is not a JSON object to find create_id_path '%s' in: %s", obj.create_id_path, err)
+		}
+		id, err := GetStringAtKey(response, obj.create_id_path, obj.debug)
+		if err != nil {
+			return fmt.Errorf("api_object.go: The object may have been created, but its id was not found at create_id_path '%s': %s", obj.create_id_path, err)
+		}
+		obj.id = id
+	}
+
+	if obj.debug {
+		log.Printf("api_object.go: Got id '%s' from the create response\n", obj.id)
+	}
+	return nil
+}
+
+/* Wraps a request body in an object for each field of request_wrapper_key */
+func (obj *api_object) wrap_request(body interface{}) interface{} {
+	if obj.request_wrapper_key == "" {
+		return body
+	}
+	parts := strings.Split(obj.request_wrapper_key, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		body = map[string]interface{}{parts[i]: body}
+	}
+	return body
+}
+
 func (obj *api_object) create_object() error {
 	/* Failsafe: The constructor should prevent this situation, but
 	   protect here also. If no id is set, and the API does not respond
 	   with the id of whatever gets created, we have no way to know what
 	   the object's id will be. Abandon this attempt */
-	if obj.id == "" && !obj.api_client.write_returns_object && !obj.api_client.create_returns_object {
+	if obj.id == "" && !obj.api_client.write_returns_object && !obj.api_client.create_returns_object && obj.operation == nil && obj.create_id_header == "" && obj.create_id_path == "" {
 		return errors.New("ERROR: Provided object does not have an id set and the client is not configured to read the object from a POST or PUT response. Without an id, the object cannot be managed.")
 	}
 
-	b, _ := json.Marshal(obj.data)
-	res_str, err := obj.api_client.send_request("POST", strings.Replace(obj.post_path, "{id}", obj.id, -1), string(b))
+	/* Adopt an object a previous (failed) run may have created */
+	if obj.upsert && obj.id != "" {
+		err := obj.read_object()
+		if err == nil {
+			if obj.debug {
+				log.Printf("api_object.go: Object '%s' already exists (upsert=true). Updating it instead\n", obj.id)
+			}
+			obj.created = true
+			return obj.update_object()
+		} else if !obj.is_not_found(err) {
+			return err
+		}
+	}
+
+	b, _ := json.Marshal(obj.wrap_request(obj.data))
+	post_path, err := obj.resolve_path(obj.post_path)
 	if err != nil {
 		return err
 	}
+	post_path = with_query_params(post_path, obj.create_query_params)
+	resp, err := obj.api_client.send_request_full(obj.create_method, post_path, string(b), obj.create_headers)
+	if err != nil {
+		if obj.on_conflict != "fail" && is_api_error_status(err, http.StatusConflict) {
+			return obj.adopt_existing_object(err)
+		}
+		return err
+	}
+	obj.created = true
+	res_str := resp.body
 
-	/* We will need to sync state as well as get the object's ID */
-	if obj.api_client.write_returns_object || obj.api_client.create_returns_object {
+	if obj.id == "" && (obj.create_id_header != "" || obj.create_id_path != "") {
+		/* Get the id before waiting on an operation too, so it is
+		   known even if the wait fails. The operation may still
+		   provide it if the response does not */
+		if err := obj.id_from_create_response(resp); err != nil {
+			if !obj.is_operation(resp) {
+				return err
+			}
+			log.Printf("api_object.go: The id of the object is not in the response starting the operation. Getting it from the operation: %s\n", err)
+		}
+	}
+
+	if obj.is_operation(resp) {
+		/* The object (or its ID) comes from the operation once it is done */
+		var result, id string
+		if result, id, err = obj.wait_for_operation(resp); err != nil {
+			return err
+		}
+		err = obj.update_from_operation(result, id)
+		if err == nil && obj.id == "" {
+			err = errors.New("The operation finished, but the object's ID could not be determined from its result. Set result_key or id_attribute.")
+		}
+	} else if obj.api_client.write_returns_object || obj.api_client.create_returns_object {
+		/* We will need to sync state as well as get the object's ID */
 		if obj.debug {
-			log.Printf("api_object.go: Parsing response from POST to update internal structures (write_returns_object=%t, create_returns_object=%t)...\n",
-				obj.api_client.write_returns_object, obj.api_client.create_returns_object)
+			log.Printf("api_object.go: Parsing response from %s to update internal structures (write_returns_object=%t, create_returns_object=%t)...\n",
+				obj.create_method, obj.api_client.write_returns_object, obj.api_client.create_returns_object)
 		}
-		err = obj.update_state(res_str)
+		err = obj.update_state_from_response(res_str)
 		/* Yet another failsafe. In case something terrible went wrong internally,
 		   bail out so the user at least knows that the ID did not get set. */
 		if obj.id == "" {
@@ -219,6 +596,13 @@ func (obj *api_object) create_object() error {
 		}
 		err = obj.read_object()
 	}
+
+	/* Some APIs only show new objects after a while. That is only
+	   waited for when there is a status to poll, as a poll block
+	   without status_key is only about deletes */
+	if err == nil || (obj.poll != nil && obj.poll.status_key != "" && obj.is_not_found(err)) {
+		err = obj.poll_until_ready()
+	}
 	return err
 }
 
@@ -227,37 +611,101 @@ func (obj *api_object) read_object() error {
 		return errors.New("Cannot read an object unless the ID has been set.")
 	}
 
-	res_str, err := obj.api_client.send_request("GET", strings.Replace(obj.get_path, "{id}", obj.id, -1), "")
+	if obj.read_search != nil {
+		search_value := strings.Replace(obj.read_search.search_value, "{id}", obj.id, -1)
+		return obj.find_object(obj.read_search.query_string, obj.read_search.search_key, search_value, obj.read_search.results_key)
+	}
+
+	get_path, err := obj.resolve_path(obj.get_path)
+	if err != nil {
+		return err
+	}
+	get_path = with_query_params(get_path, obj.read_query_params)
+	res_str, err := obj.api_client.send_request_with_headers(obj.read_method, get_path, "", obj.read_headers)
 	if err != nil {
 		return err
 	}
 
-	err = obj.update_state(res_str)
+	/* Some APIs answer 200 for objects that are gone, such as {"deleted": true} */
+	if obj.not_found_body_regex != nil && obj.not_found_body_regex.MatchString(res_str) {
+		return &object_not_found_error{message: fmt.Sprintf("The object at '%s' does not exist (response matched not_found_body_regex '%s')", get_path, obj.not_found_body_regex.String())}
+	}
+
+	err = obj.update_state_from_response(res_str)
 	return err
 }
 
+/* Returned by read_object when the response body says the object is gone */
+type object_not_found_error struct {
+	message string
+}
+
+func (err *object_not_found_error) Error() string {
+	return err.message
+}
+
+/* Whether err means the object does not exist on the server according
+   to not_found_status_codes and not_found_body_regex */
+func (obj *api_object) is_not_found(err error) bool {
+	if _, ok := err.(*object_not_found_error); ok {
+		return true
+	}
+	return is_api_error_status(err, obj.not_found_status_codes...)
+}
+
 func (obj *api_object) update_object() error {
 	if obj.id == "" {
 		return errors.New("Cannot update an object unless the ID has been set.")
 	}
 
-	b, _ := json.Marshal(obj.data)
-	res_str, err := obj.api_client.send_request("PUT", strings.Replace(obj.put_path, "{id}", obj.id, -1), string(b))
+	var b []byte
+	var headers map[string]string
+	switch obj.update_body_format {
+	case "merge_patch":
+		b, _ = json.Marshal(obj.wrap_request(merge_patch(obj.previous_data, obj.data)))
+		headers = map[string]string{"Content-Type": "application/merge-patch+json"}
+	case "json_patch":
+		/* The changes are made under the wrapper rather than wrapping the patch */
+		b, _ = json.Marshal(append_json_patch(make([]map[string]interface{}, 0), json_pointer(obj.request_wrapper_key), obj.previous_data, obj.data))
+		headers = map[string]string{"Content-Type": "application/json-patch+json"}
+	default:
+		b, _ = json.Marshal(obj.wrap_request(obj.data))
+	}
+	/* A Content-Type set by the user wins over the patch one */
+	headers = merge_string_maps(headers, obj.update_headers)
+
+	put_path, err := obj.resolve_path(obj.put_path)
+	if err != nil {
+		return err
+	}
+	put_path = with_query_params(put_path, obj.update_query_params)
+	resp, err := obj.api_client.send_request_full(obj.update_method, put_path, string(b), headers)
 	if err != nil {
 		return err
 	}
+	res_str := resp.body
 
-	if obj.api_client.write_returns_object {
+	if obj.is_operation(resp) {
+		var result, id string
+		if result, id, err = obj.wait_for_operation(resp); err != nil {
+			return err
+		}
+		err = obj.update_from_operation(result, id)
+	} else if obj.api_client.write_returns_object {
 		if obj.debug {
-			log.Printf("api_object.go: Parsing response from PUT to update internal structures (write_returns_object=true)...\n")
+			log.Printf("api_object.go: Parsing response from %s to update internal structures (write_returns_object=true)...\n", obj.update_method)
 		}
-		err = obj.update_state(res_str)
+		err = obj.update_state_from_response(res_str)
 	} else {
 		if obj.debug {
 			log.Printf("api_object.go: Requesting updated object from API (write_returns_object=false)...\n")
 		}
 		err = obj.read_object()
 	}
+
+	if err == nil {
+		err = obj.poll_until_ready()
+	}
 	return err
 }
 
@@ -267,12 +715,23 @@ func (obj *api_object) delete_object() error {
 		return nil
 	}
 
-	_, err := obj.api_client.send_request("DELETE", strings.Replace(obj.delete_path, "{id}", obj.id, -1), "")
+	delete_path, err := obj.resolve_path(obj.delete_path)
+	if err != nil {
+		return err
+	}
+	delete_path = with_query_params(delete_path, obj.destroy_query_params)
+	resp, err := obj.api_client.send_request_full(obj.destroy_method, delete_path, "", obj.destroy_headers)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if obj.is_operation(resp) {
+		if _, _, err := obj.wait_for_operation(resp); err != nil {
+			return err
+		}
+	}
+
+	return obj.poll_until_gone()
 }
 
 func (obj *api_object) find_object(query_string string, search_key string, search_value string, results_key string) error {
@@ -280,20 +739,24 @@ func (obj *api_object) find_object(query_string string, search_key string, searc
 	var ok bool
 
 	/*
-	   Issue a GET to the base path and expect results to come back
+	   Issue a read (GET by default) to the base path and expect results to come back
 	*/
-	search_path := obj.search_path
+	search_path, err := obj.resolve_path(obj.search_path)
+	if err != nil {
+		return err
+	}
 	if "" != query_string {
 		if obj.debug {
 			log.Printf("datasource_api_object.go: Adding query string '%s'", query_string)
 		}
-		search_path = fmt.Sprintf("%s?%s", obj.search_path, query_string)
+		search_path = fmt.Sprintf("%s?%s", search_path, query_string)
 	}
+	search_path = with_query_params(search_path, obj.read_query_params)
 
 	if obj.debug {
 		log.Printf("datasource_api_object.go: Calling API on path '%s'", search_path)
 	}
-	res_str, err := obj.api_client.send_request("GET", search_path, "")
+	res_str, err := obj.api_client.send_request_with_headers(obj.read_method, search_path, "", obj.read_headers)
 	if err != nil {
 		return err
 	}
@@ -305,7 +768,7 @@ func (obj *api_object) find_object(query_string string, search_key string, searc
 		log.Printf("datasource_api_object.go: Response recieved... parsing")
 	}
 	var result interface{}
-	err = json.Unmarshal([]byte(res_str), &result)
+	err = json_decode(res_str, &result)
 	if err != nil {
 		return err
 	}
@@ -339,6 +802,7 @@ func (obj *api_object) find_object(query_string string, search_key string, searc
 	}
 
 	/* Loop through all of the results seeking the specific record */
+	found := false
 	for _, item := range data_array {
 		var hash map[string]interface{}
 
@@ -358,26 +822,66 @@ func (obj *api_object) find_object(query_string string, search_key string, searc
 
 		/* We found our record */
 		if tmp == search_value {
-			obj.id, err = GetStringAtKey(hash, obj.id_attribute, obj.debug)
+			id, err := GetStringAtKey(hash, obj.id_attribute, obj.debug)
 			if err != nil {
 				return (fmt.Errorf("Failed to find id_attribute '%s' in the record: %s", obj.id_attribute, err))
 			}
 
 			if obj.debug {
-				log.Printf("datasource_api_object.go:   Found ID '%s'", obj.id)
+				log.Printf("datasource_api_object.go:   Found ID '%s'", id)
 			}
 
-			/* But there is no id attribute??? */
-			if "" == obj.id {
+			/* But there is no id attribute??? Keep the id we had rather than losing it */
+			if "" == id {
 				return (errors.New(fmt.Sprintf("The object for '%s'='%s' did not have the id attribute '%s', or the value was empty.", search_key, search_value, obj.id_attribute)))
 			}
+			obj.id = id
+
+			/* Keep the record so it does not have to be read again */
+			record, _ := json.Marshal(hash)
+			if err := obj.update_state(string(record)); err != nil {
+				return err
+			}
+			found = true
 			break
 		}
 	}
 
-	if "" == obj.id {
-		return (fmt.Errorf("Failed to find an object with the '%s' key = '%s' at %s", search_key, search_value, search_path))
+	if !found {
+		return &object_not_found_error{message: fmt.Sprintf("Failed to find an object with the '%s' key = '%s' at %s", search_key, search_value, search_path)}
 	}
 
 	return nil
 }
+
+/* Returns a copy of base with the keys of override set over it,
+   or nil if both are empty */
+func merge_string_maps(base map[string]string, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+/* Appends the (escaped) query parameters to path, which may
+   already have a query string of its own */
+func with_query_params(path string, params map[string]string) string {
+	if len(params) == 0 {
+		return path
+	}
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	if strings.Contains(path, "?") {
+		return path + "&" + values.Encode()
+	}
+	return path + "?" + values.Encode()
+}
@@ -0,0 +1,147 @@
+package restapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+/* Settings for APIs that answer writes with 202 Accepted and a
+   header pointing at an operation resource. The operation is read
+   until it is done and the object (or its id) is taken from it */
+type operationOpt struct {
+	location_header string
+	status_key      string
+	success_values  []string
+	failure_values  []string
+	result_key      string
+	interval        time.Duration
+	timeout         time.Duration
+}
+
+func validate_operation_opt(opt *operationOpt) error {
+	if opt.status_key != "" && len(opt.success_values) == 0 {
+		return fmt.Errorf("operation: success_values must be set when status_key is set")
+	}
+	if opt.interval <= 0 {
+		opt.interval = 5 * time.Second
+	}
+	if opt.timeout <= 0 {
+		opt.timeout = 10 * time.Minute
+	}
+	return nil
+}
+
+/* Whether resp started a long-running operation this object should wait for */
+func (obj *api_object) is_operation(resp *api_response) bool {
+	return obj.operation != nil && resp.status_code == 202 && obj.operation_location(resp) != ""
+}
+
+/* Where to follow the operation. A relative location is resolved
+   against the URL of the request that started it (RFC 7231) */
+func (obj *api_object) operation_location(resp *api_response) string {
+	location := resp.headers.Get("Location")
+	if obj.operation.location_header != "" {
+		location = resp.headers.Get(obj.operation.location_header)
+	} else if op_location := resp.headers.Get("Operation-Location"); op_location != "" {
+		location = op_location
+	}
+
+	if location == "" || resp.url == nil {
+		return location
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	return resp.url.ResolveReference(ref).String()
+}
+
+/* Read the operation resource until it is done. Returns the JSON of the
+   resulting object, or only its id if that is all the operation holds.
+   Both are empty if the operation is done but carries no result */
+func (obj *api_object) wait_for_operation(resp *api_response) (result string, id string, err error) {
+	location := obj.operation_location(resp)
+	if obj.debug {
+		log.Printf("api_object_operation.go: Following operation at '%s'\n", location)
+	}
+
+	deadline := time.Now().Add(obj.operation.timeout)
+	for {
+		op_resp, err := obj.api_client.send_request_full("GET", location, "", obj.read_headers)
+		if err != nil {
+			return "", "", err
+		}
+
+		done := false
+		if obj.operation.status_key == "" {
+			/* Without a status, the operation is done once it stops answering 202 */
+			done = op_resp.status_code != 202
+		} else {
+			var op_data map[string]interface{}
+			if err := json_decode(op_resp.body, &op_data); err != nil {
+				return "", "", fmt.Errorf("api_object_operation.go: The operation at '%s' did not return a JSON object: %s", location, err)
+			}
+
+			status, err := GetObjectAtKey(op_data, obj.operation.status_key, obj.debug)
+			if err != nil {
+				return "", "", fmt.Errorf("api_object_operation.go: Failed to find the status of the operation at '%s': %s", location, err)
+			}
+			status_str := fmt.Sprintf("%v", status)
+			if contains_string(obj.operation.failure_values, status_str) {
+				return "", "", fmt.Errorf("api_object_operation.go: The operation at '%s' failed with status '%s': %s", location, status_str, op_resp.body)
+			}
+			done = contains_string(obj.operation.success_values, status_str)
+		}
+
+		if done {
+			return obj.operation_result(op_resp.body)
+		}
+
+		log.Printf("api_object_operation.go: Operation at '%s' is not done. Waiting %s...\n", location, obj.operation.interval)
+		if time.Now().Add(obj.operation.interval).After(deadline) {
+			return "", "", fmt.Errorf("api_object_operation.go: Timed out after %s waiting for the operation at '%s'", obj.operation.timeout, location)
+		}
+		time.Sleep(obj.operation.interval)
+	}
+}
+
+/* Pull the object (or its id) from a finished operation. Without
+   a result_key, the operation resource is the object itself */
+func (obj *api_object) operation_result(body string) (result string, id string, err error) {
+	if obj.operation.result_key == "" {
+		return body, "", nil
+	}
+
+	var op_data map[string]interface{}
+	if err := json_decode(body, &op_data); err != nil {
+		return "", "", fmt.Errorf("api_object_operation.go: The finished operation did not return a JSON object: %s", err)
+	}
+
+	value, err := GetObjectAtKey(op_data, obj.operation.result_key, obj.debug)
+	if err != nil {
+		return "", "", fmt.Errorf("api_object_operation.go: Failed to find result_key '%s' in the finished operation: %s", obj.operation.result_key, err)
+	}
+
+	switch value.(type) {
+	case map[string]interface{}:
+		b, _ := json.Marshal(value)
+		return string(b), "", nil
+	case string, json.Number:
+		return "", fmt.Sprintf("%v", value), nil
+	}
+	return "", "", fmt.Errorf("api_object_operation.go: The value at result_key '%s' is neither an object nor an id. It is a '%T'", obj.operation.result_key, value)
+}
+
+/* Bring the object up to date from a finished operation */
+func (obj *api_object) update_from_operation(result string, id string) error {
+	if id != "" && obj.id == "" {
+		obj.id = id
+	}
+	if result != "" {
+		return obj.update_state(result)
+	}
+	return obj.read_object()
+}
@@ -0,0 +1,128 @@
+package restapi
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAPIObjectOperation(t *testing.T) {
+	var operation_reads int32
+
+	client, svr := new_test_client(t, map[string]http.HandlerFunc{
+		"/api/things": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Operation-Location", "/api/operations/1")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{ "id": "abc" }`))
+		},
+		"/api/relative": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "operations/1")
+			w.WriteHeader(http.StatusAccepted)
+		},
+		"/api/operations/1": func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&operation_reads, 1) < 3 {
+				w.Write([]byte(`{ "status": "running" }`))
+				return
+			}
+			w.Write([]byte(`{ "status": "succeeded", "resource": { "id": "abc", "name": "foo" }, "resourceId": "abc" }`))
+		},
+		"/api/things/abc": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{ "id": "abc", "name": "read back" }`))
+		},
+	}, &apiClientOpt{uri: "/api"})
+	defer svr.Close()
+
+	/* The operation result holds the whole object */
+	t.Run("result_object", func(t *testing.T) {
+		atomic.StoreInt32(&operation_reads, 0)
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path: "/things",
+			data: `{ "name": "foo" }`,
+			operation: &operationOpt{
+				status_key:     "status",
+				success_values: []string{"succeeded"},
+				failure_values: []string{"failed"},
+				result_key:     "resource",
+				interval:       10 * time.Millisecond,
+				timeout:        time.Second,
+			},
+		})
+		if err != nil {
+			t.Fatalf("api_object_operation_test.go: %s", err)
+		}
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_operation_test.go: Failed in create_object(): %s", err)
+		}
+		if n := atomic.LoadInt32(&operation_reads); object.id != "abc" || object.api_data["name"] != "foo" || n != 3 {
+			t.Fatalf("api_object_operation_test.go: Expected id 'abc' and name 'foo' after 3 reads, got '%s' and '%v' after %d", object.id, object.api_data["name"], n)
+		}
+	})
+
+	/* The operation result only holds the id, so the object is read */
+	t.Run("result_id", func(t *testing.T) {
+		atomic.StoreInt32(&operation_reads, 0)
+		object, _ := NewAPIObject(client, &apiObjectOpts{
+			path: "/things",
+			data: `{ "name": "foo" }`,
+			operation: &operationOpt{
+				status_key:     "status",
+				success_values: []string{"succeeded"},
+				result_key:     "resourceId",
+				interval:       10 * time.Millisecond,
+				timeout:        time.Second,
+			},
+		})
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_operation_test.go: Failed in create_object(): %s", err)
+		}
+		if object.id != "abc" || object.api_data["name"] != "read back" {
+			t.Fatalf("api_object_operation_test.go: Expected id 'abc' and name 'read back', got '%s' and '%v'", object.id, object.api_data["name"])
+		}
+	})
+
+	/* A location without a leading / is relative to the request, not the base uri */
+	t.Run("relative_location", func(t *testing.T) {
+		atomic.StoreInt32(&operation_reads, 0)
+		object, _ := NewAPIObject(client, &apiObjectOpts{
+			path:      "/things",
+			post_path: "/relative",
+			data:      `{ "name": "foo" }`,
+			operation: &operationOpt{
+				status_key:     "status",
+				success_values: []string{"succeeded"},
+				result_key:     "resource",
+				interval:       10 * time.Millisecond,
+				timeout:        time.Second,
+			},
+		})
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_operation_test.go: Failed in create_object(): %s", err)
+		}
+		if object.id != "abc" {
+			t.Fatalf("api_object_operation_test.go: Expected id 'abc', got '%s'", object.id)
+		}
+	})
+
+	/* Give up eventually, but keep the id the create response had */
+	t.Run("timeout", func(t *testing.T) {
+		atomic.StoreInt32(&operation_reads, -100)
+		object, _ := NewAPIObject(client, &apiObjectOpts{
+			path:           "/things",
+			data:           `{ "name": "foo" }`,
+			create_id_path: "id",
+			operation: &operationOpt{
+				status_key:     "status",
+				success_values: []string{"succeeded"},
+				interval:       10 * time.Millisecond,
+				timeout:        50 * time.Millisecond,
+			},
+		})
+		if err := object.create_object(); err == nil {
+			t.Fatalf("api_object_operation_test.go: create_object() did not time out waiting for the operation")
+		}
+		if object.id != "abc" || !object.created {
+			t.Fatalf("api_object_operation_test.go: Expected id 'abc' to be kept after the timeout, got '%s'", object.id)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package restapi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var path_placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+/* Replaces the placeholders in a path template with their
+   URL path-escaped values:
+     {id}             the object's id
+     {data.a/b}       the value at a/b in data
+     {api_data.a/b}   the value at a/b in api_data
+     {name}           path_variables["name"], or else the value
+                      at name in data, then in api_data */
+func (obj *api_object) resolve_path(path string) (string, error) {
+	var err error
+	resolved := path_placeholder.ReplaceAllStringFunc(path, func(placeholder string) string {
+		if err != nil {
+			return placeholder
+		}
+		name := placeholder[1 : len(placeholder)-1]
+
+		var value string
+		var ok bool
+		switch {
+		case name == "id":
+			value, ok = obj.id, true
+		case strings.HasPrefix(name, "data."):
+			value, ok = lookup_string(obj.data, strings.TrimPrefix(name, "data."), obj.debug)
+		case strings.HasPrefix(name, "api_data."):
+			value, ok = lookup_string(obj.api_data, strings.TrimPrefix(name, "api_data."), obj.debug)
+		default:
+			if value, ok = obj.path_variables[name]; !ok {
+				if value, ok = lookup_string(obj.data, name, obj.debug); !ok {
+					value, ok = lookup_string(obj.api_data, name, obj.debug)
+				}
+			}
+		}
+
+		if !ok {
+			err = fmt.Errorf("Cannot resolve '%s' in path '%s'. It is not in path_variables, data or api_data", placeholder, path)
+			return placeholder
+		}
+		return url.PathEscape(value)
+	})
+	return resolved, err
+}
+
+func lookup_string(data map[string]interface{}, key string, debug bool) (string, bool) {
+	if len(data) == 0 {
+		return "", false
+	}
+	value, err := GetStringAtKey(data, key, debug)
+	return value, err == nil
+}
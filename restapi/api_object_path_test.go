@@ -0,0 +1,47 @@
+package restapi
+
+import (
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	client, svr := new_test_client(t, nil, nil)
+	defer svr.Close()
+
+	obj, err := NewAPIObject(client, &apiObjectOpts{
+		path:           "/things",
+		id:             "a/b c",
+		data:           `{ "id": "a/b c", "org_id": "42", "team": { "slug": "dev ops" } }`,
+		api_data:       map[string]string{"etag": "v1"},
+		path_variables: map[string]string{"org_id": "7"},
+	})
+	if err != nil {
+		t.Fatalf("api_object_path_test.go: %s", err)
+	}
+
+	tests := map[string]string{
+		"/things/{id}": "/things/a%2Fb%20c",
+		"/orgs/{org_id}/teams/{data.team/slug}/members/{id}": "/orgs/7/teams/dev%20ops/members/a%2Fb%20c",
+		"/orgs/{data.org_id}":                                "/orgs/42",
+		"/versions/{etag}":                                   "/versions/v1",
+		"/versions/{api_data.etag}":                          "/versions/v1",
+		"/things":                                            "/things",
+	}
+	for template, expected := range tests {
+		template, expected := template, expected
+		t.Run(template, func(t *testing.T) {
+			path, err := obj.resolve_path(template)
+			if err != nil {
+				t.Errorf("api_object_path_test.go: Failed to resolve '%s': %s", template, err)
+			} else if path != expected {
+				t.Errorf("api_object_path_test.go: Expected '%s' to resolve to '%s', got '%s'", template, expected, path)
+			}
+		})
+	}
+
+	t.Run("unknown_placeholder", func(t *testing.T) {
+		if _, err := obj.resolve_path("/things/{nope}"); err == nil {
+			t.Errorf("api_object_path_test.go: Expected an error for an unknown placeholder")
+		}
+	})
+}
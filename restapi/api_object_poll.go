@@ -0,0 +1,118 @@
+package restapi
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+/* Settings for APIs that finish creating, updating or deleting
+   objects in the background. After each of those operations, the
+   object is read until the value at status_key is one of
+   success_values (or, after a delete, until it is gone) */
+type pollOpt struct {
+	status_key     string
+	success_values []string
+	failure_values []string
+	interval       time.Duration
+	timeout        time.Duration
+}
+
+func validate_poll_opt(opt *pollOpt) error {
+	if opt.status_key != "" && len(opt.success_values) == 0 {
+		return fmt.Errorf("poll: success_values must be set when status_key is set")
+	}
+	if opt.interval <= 0 {
+		opt.interval = 5 * time.Second
+	}
+	if opt.timeout <= 0 {
+		opt.timeout = 10 * time.Minute
+	}
+	return nil
+}
+
+/* Read the object until its status is one of the success_values.
+   A failure value or running out of time is an error. Not found
+   is tolerated since some APIs only show new objects after a while */
+func (obj *api_object) poll_until_ready() error {
+	if obj.poll == nil || obj.poll.status_key == "" {
+		return nil
+	}
+
+	deadline := time.Now().Add(obj.poll.timeout)
+	for {
+		err := obj.read_object()
+		if err == nil {
+			status, err := GetObjectAtKey(obj.api_data, obj.poll.status_key, obj.debug)
+			if err != nil {
+				return fmt.Errorf("api_object_poll.go: Failed to find the status of object '%s': %s", obj.id, err)
+			}
+
+			status_str := fmt.Sprintf("%v", status)
+			if contains_string(obj.poll.success_values, status_str) {
+				if obj.debug {
+					log.Printf("api_object_poll.go: Object '%s' reached status '%s'\n", obj.id, status_str)
+				}
+				return nil
+			}
+			if contains_string(obj.poll.failure_values, status_str) {
+				return fmt.Errorf("api_object_poll.go: Object '%s' reached failed status '%s'", obj.id, status_str)
+			}
+			log.Printf("api_object_poll.go: Object '%s' has status '%s'. Waiting %s...\n", obj.id, status_str, obj.poll.interval)
+		} else if obj.is_not_found(err) {
+			log.Printf("api_object_poll.go: Object '%s' is not available yet. Waiting %s...\n", obj.id, obj.poll.interval)
+		} else {
+			return err
+		}
+
+		if time.Now().Add(obj.poll.interval).After(deadline) {
+			return fmt.Errorf("api_object_poll.go: Timed out after %s waiting for object '%s' to reach one of %v", obj.poll.timeout, obj.id, obj.poll.success_values)
+		}
+		time.Sleep(obj.poll.interval)
+	}
+}
+
+/* Read the object until the API reports it as not found */
+func (obj *api_object) poll_until_gone() error {
+	if obj.poll == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(obj.poll.timeout)
+	for {
+		err := obj.read_object()
+		if obj.is_not_found(err) {
+			if obj.debug {
+				log.Printf("api_object_poll.go: Object '%s' is gone\n", obj.id)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if obj.poll.status_key != "" {
+			if status, err := GetObjectAtKey(obj.api_data, obj.poll.status_key, obj.debug); err == nil {
+				status_str := fmt.Sprintf("%v", status)
+				if contains_string(obj.poll.failure_values, status_str) {
+					return fmt.Errorf("api_object_poll.go: Object '%s' reached failed status '%s' while being deleted", obj.id, status_str)
+				}
+			}
+		}
+		log.Printf("api_object_poll.go: Object '%s' still exists. Waiting %s...\n", obj.id, obj.poll.interval)
+
+		if time.Now().Add(obj.poll.interval).After(deadline) {
+			return fmt.Errorf("api_object_poll.go: Timed out after %s waiting for object '%s' to be deleted", obj.poll.timeout, obj.id)
+		}
+		time.Sleep(obj.poll.interval)
+	}
+}
+
+func contains_string(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
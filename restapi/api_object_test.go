@@ -5,8 +5,14 @@ import (
 	"fmt"
 	"github.com/Mastercard/terraform-provider-restapi/fakeserver"
 	mylog "github.com/Mastercard/terraform-provider-restapi/log"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var debug = true
@@ -79,6 +85,12 @@ var testing_data_objects = []string{
         "weight": "15 lb"
       }
     }`,
+	`{
+      "Test_case": "deleted",
+      "Id": "6",
+      "Thing": "ghost",
+      "Deleted": true
+    }`,
 }
 
 var client, err = NewAPIClient(&apiClientOpt{
@@ -230,6 +242,28 @@ func TestAPIObject(t *testing.T) {
 		if err == nil {
 			t.Fatalf("api_object_test.go: 'pet' object deleted, but 404 not returned when getting it.\n")
 		}
+		if !testing_objects["pet"].is_not_found(err) {
+			t.Fatalf("api_object_test.go: 'pet' object deleted, but the error is not recognized as not found: %s\n", err)
+		}
+	})
+
+	/* An object the API still returns, but marks as deleted */
+	t.Run("not_found_body_regex", func(t *testing.T) {
+		object_opts := &apiObjectOpts{
+			path:                 "/api/objects",
+			id:                   "6",
+			not_found_body_regex: `"Deleted":\s*true`,
+			debug:                api_object_debug,
+		}
+		object, err := NewAPIObject(client, object_opts)
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object: %s", err)
+		}
+
+		err = object.read_object()
+		if !object.is_not_found(err) {
+			t.Fatalf("api_object_test.go: Expected object '6' to be not found, but got: %v\n", err)
+		}
 	})
 
 	/* Recreate the one we just got rid of */
@@ -256,6 +290,111 @@ func TestAPIObject(t *testing.T) {
 		}
 	})
 
+	/* Update with PATCH instead of PUT. fakeserver merges the fields sent */
+	t.Run("update_method", func(t *testing.T) {
+		object_opts := &apiObjectOpts{
+			path:          "/api/objects",
+			id:            "3",
+			update_method: "PATCH",
+			data:          `{ "Thing": "rock" }`,
+			debug:         api_object_debug,
+		}
+		object, err := NewAPIObject(client, object_opts)
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object: %s", err)
+		}
+
+		if err := object.update_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in update_object() test: %s", err)
+		}
+		if object.api_data["Thing"] != "rock" || object.api_data["Test_case"] != "no Colors" {
+			t.Fatalf("api_object_test.go: PATCH did not merge 'Thing' into object '3': %+v\n", object.api_data)
+		}
+	})
+
+	/* Only send what changed since the previous data */
+	t.Run("update_body_format", func(t *testing.T) {
+		object_opts := &apiObjectOpts{
+			path:               "/api/objects",
+			id:                 "4",
+			update_method:      "PATCH",
+			update_body_format: "merge_patch",
+			previous_data:      `{ "Thing": "nothing", "Is_cat": false }`,
+			data:               `{ "Thing": "something" }`,
+			debug:              api_object_debug,
+		}
+		object, err := NewAPIObject(client, object_opts)
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object: %s", err)
+		}
+
+		if err := object.update_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in update_object() test: %s", err)
+		}
+		if _, ok := object.api_data["Is_cat"]; ok || object.api_data["Thing"] != "something" || object.api_data["Test_case"] != "no Attrs" {
+			t.Fatalf("api_object_test.go: Merge patch was not applied as expected to object '4': %+v\n", object.api_data)
+		}
+	})
+
+	/* Wait for a status after create and for the object to be gone after delete */
+	t.Run("poll", func(t *testing.T) {
+		poll := &pollOpt{
+			status_key:     "Status/Phase",
+			success_values: []string{"Ready"},
+			failure_values: []string{"Failed"},
+			interval:       10 * time.Millisecond,
+			timeout:        time.Second,
+		}
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path:  "/api/objects",
+			data:  `{ "Id": "7", "Status": { "Phase": "Ready" } }`,
+			poll:  poll,
+			debug: api_object_debug,
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object: %s", err)
+		}
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in create_object() with poll: %s", err)
+		}
+		if err := object.delete_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in delete_object() with poll: %s", err)
+		}
+
+		object, _ = NewAPIObject(client, &apiObjectOpts{
+			path:  "/api/objects",
+			data:  `{ "Id": "8", "Status": { "Phase": "Failed" } }`,
+			poll:  poll,
+			debug: api_object_debug,
+		})
+		if err := object.create_object(); err == nil {
+			t.Fatalf("api_object_test.go: create_object() with poll did not fail on a failure status")
+		}
+		object.delete_object()
+	})
+
+	/* Without a status to poll for, an object that cannot be read back is an error */
+	t.Run("poll_without_status_key", func(t *testing.T) {
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things": func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		}, nil)
+		defer svr.Close()
+
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path: "/things",
+			data: `{ "id": "1" }`,
+			poll: &pollOpt{interval: 10 * time.Millisecond, timeout: time.Second},
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: %s", err)
+		}
+		if err := object.create_object(); !object.is_not_found(err) {
+			t.Fatalf("api_object_test.go: Expected create_object() to fail with the object not found, got %v", err)
+		}
+	})
+
 	t.Run("find_object", func(t *testing.T) {
 		object_opts := &apiObjectOpts{
 			path:  "/api/objects",
@@ -279,21 +418,343 @@ func TestAPIObject(t *testing.T) {
 		}
 	})
 
-	// t.Run("create_with_put", func(t *testing.T) {
-	// 	object_opts := &apiObjectOpts{
-	// 		path:            "/api/objects",
-	// 		create_with_put: true,
-	// 		debug:           api_object_debug,
-	// 	}
-	// 	object, err := NewAPIObject(client, object_opts)
-	// 	if err != nil {
-	// 		t.Fatalf("api_object_test.go: Failed to create new api_object to find")
-	// 	}
-
-	// 	if err := object.update_object(); err != nil {
-	// 		t.Fatalf("api_object_test.go: Failed to update api_objects: %s", err)
-	// 	}
-	// })
+	t.Run("create_with_put", func(t *testing.T) {
+		object_opts := &apiObjectOpts{
+			path:            "/api/objects",
+			post_path:       "/api/objects/{id}",
+			create_with_put: true,
+			data:            `{ "Id": "9", "Thing": "hat" }`,
+			debug:           api_object_debug,
+		}
+		object, err := NewAPIObject(client, object_opts)
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object to create with PUT")
+		}
+
+		/* fakeserver only accepts POST on the collection, so this only works with PUT */
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed to create api_object with PUT: %s", err)
+		} else if api_server_objects["9"]["Thing"] != "hat" {
+			t.Fatalf("api_object_test.go: Expected object 9 to be created on the server, got %v", api_server_objects["9"])
+		}
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		/* Object 2 exists, so it is updated. PATCH keeps the fields not sent */
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path:          "/api/objects",
+			upsert:        true,
+			update_method: "PATCH",
+			data:          `{ "Id": "2", "Extra": "yes" }`,
+			debug:         api_object_debug,
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: Failed to create new api_object to upsert")
+		}
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed to upsert existing api_object: %s", err)
+		} else if api_server_objects["2"]["Extra"] != "yes" || api_server_objects["2"]["Thing"] == nil {
+			t.Fatalf("api_object_test.go: Expected object 2 to be patched, got %v", api_server_objects["2"])
+		}
+
+		/* Object 10 does not exist, so it is created */
+		object, _ = NewAPIObject(client, &apiObjectOpts{
+			path:   "/api/objects",
+			upsert: true,
+			data:   `{ "Id": "10", "Thing": "shoe" }`,
+			debug:  api_object_debug,
+		})
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed to upsert new api_object: %s", err)
+		} else if api_server_objects["10"]["Thing"] != "shoe" {
+			t.Fatalf("api_object_test.go: Expected object 10 to be created, got %v", api_server_objects["10"])
+		}
+	})
+
+	/* Per-object headers go over the client headers, and query parameters are added per operation */
+	t.Run("headers_and_query_params", func(t *testing.T) {
+		requests := make(map[string]*http.Request)
+
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things/1": func(w http.ResponseWriter, r *http.Request) {
+				requests[r.Method] = r
+				w.Write([]byte(`{ "id": "1" }`))
+			},
+		}, &apiClientOpt{
+			headers: map[string]string{"Accept": "application/json", "X-Provider": "yes"},
+		})
+		defer svr.Close()
+
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path:                 "/things",
+			post_path:            "/things/1",
+			data:                 `{ "id": "1" }`,
+			update_method:        "PATCH",
+			headers:              map[string]string{"Accept": "application/vnd.things.v2+json"},
+			create_headers:       map[string]string{"X-Create": "yes"},
+			query_params:         map[string]string{"tenant": "a b"},
+			destroy_query_params: map[string]string{"tenant": "other", "force": "true"},
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: %s", err)
+		}
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in create_object(): %s", err)
+		}
+		if err := object.update_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in update_object(): %s", err)
+		}
+		if err := object.delete_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in delete_object(): %s", err)
+		}
+
+		for method, r := range requests {
+			if r.Header.Get("Accept") != "application/vnd.things.v2+json" || r.Header.Get("X-Provider") != "yes" {
+				t.Errorf("api_object_test.go: %s did not merge the object headers over the client headers: %v", method, r.Header)
+			}
+			if (r.Header.Get("X-Create") == "yes") != (method == "POST") {
+				t.Errorf("api_object_test.go: X-Create should only be sent on POST, got it on %s", method)
+			}
+		}
+		if q := requests["GET"].URL.RawQuery; q != "tenant=a+b" {
+			t.Errorf("api_object_test.go: Expected query 'tenant=a+b' on GET, got '%s'", q)
+		}
+		if q := requests["DELETE"].URL.RawQuery; q != "force=true&tenant=other" {
+			t.Errorf("api_object_test.go: Expected query 'force=true&tenant=other' on DELETE, got '%s'", q)
+		}
+		if p := with_query_params("/things?a=1", map[string]string{"b": "2"}); p != "/things?a=1&b=2" {
+			t.Errorf("api_object_test.go: Expected '/things?a=1&b=2', got '%s'", p)
+		}
+	})
+
+	/* Objects wrapped in an envelope in responses and requests */
+	t.Run("envelope", func(t *testing.T) {
+		var bodies []string
+
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things": func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				w.Write([]byte(`{ "data": { "attributes": { "id": 9007199254740993, "name": "foo", "revision": 1 } }, "meta": { "request": "a" } }`))
+			},
+			"/things/9007199254740993": func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				w.Write([]byte(`{ "data": { "attributes": { "id": 9007199254740993, "name": "bar", "revision": 2 } }, "meta": { "request": "b" } }`))
+			},
+		}, &apiClientOpt{
+			write_returns_object: true,
+			copy_keys:            []string{"revision"},
+			response_object_key:  "data/attributes",
+			request_wrapper_key:  "data",
+		})
+		defer svr.Close()
+
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path: "/things",
+			data: `{ "name": "foo" }`,
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: %s", err)
+		}
+		if err := object.create_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in create_object(): %s", err)
+		}
+		if object.id != "9007199254740993" || object.api_data["name"] != "foo" {
+			t.Fatalf("api_object_test.go: Expected id '9007199254740993' and name 'foo' from the envelope, got '%s' and '%v'", object.id, object.api_data["name"])
+		}
+		if fmt.Sprintf("%v", object.data["revision"]) != "1" {
+			t.Errorf("api_object_test.go: Expected revision 1 to be copied from the envelope, got '%v'", object.data["revision"])
+		}
+		if !strings.Contains(object.api_response, `"meta"`) {
+			t.Errorf("api_object_test.go: Expected api_response to keep the envelope, got '%s'", object.api_response)
+		}
+
+		object.data["name"] = "bar"
+		if err := object.update_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in update_object(): %s", err)
+		}
+		if object.api_data["name"] != "bar" {
+			t.Errorf("api_object_test.go: Expected name 'bar' after the update, got '%v'", object.api_data["name"])
+		}
+
+		expected := []string{`{"data":{"name":"foo"}}`, `{"data":{"name":"bar","revision":1}}`}
+		if !reflect.DeepEqual(bodies, expected) {
+			t.Errorf("api_object_test.go: Expected the requests to be wrapped as %v, got %v", expected, bodies)
+		}
+
+		/* JSON patches change the data under the wrapper */
+		object.update_body_format = "json_patch"
+		object.previous_data = map[string]interface{}{"name": "bar"}
+		object.data = map[string]interface{}{"name": "baz"}
+		bodies = nil
+		if err := object.update_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in update_object(): %s", err)
+		}
+		if len(bodies) != 1 || bodies[0] != `[{"op":"replace","path":"/data/name","value":"baz"}]` {
+			t.Errorf("api_object_test.go: Expected a JSON patch of /data/name, got %v", bodies)
+		}
+	})
+
+	/* The id of a created object from a response header or create_id_path */
+	t.Run("create_id", func(t *testing.T) {
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", "/things/abc%20123/")
+				w.Header().Set("X-Object-Id", "def456")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{ "result": { "id": 789 } }`))
+			},
+			"/things/": func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{ "id": "read", "name": "foo" }`))
+			},
+		}, nil)
+		defer svr.Close()
+
+		tests := []struct {
+			opts     *apiObjectOpts
+			expected string
+		}{
+			{&apiObjectOpts{path: "/things", create_id_header: "Location"}, "abc 123"},
+			{&apiObjectOpts{path: "/things", create_id_header: "X-Object-Id"}, "def456"},
+			{&apiObjectOpts{path: "/things", create_id_path: "result/id"}, "789"},
+		}
+		for _, test := range tests {
+			object, err := NewAPIObject(client, test.opts)
+			if err != nil {
+				t.Fatalf("api_object_test.go: %s", err)
+			}
+			if err := object.create_object(); err != nil {
+				t.Fatalf("api_object_test.go: Failed in create_object(): %s", err)
+			}
+			if object.id != test.expected || object.api_data["name"] != "foo" {
+				t.Errorf("api_object_test.go: Expected id '%s' and the object to be read, got '%s' and %v", test.expected, object.id, object.api_data)
+			}
+		}
+
+		object, _ := NewAPIObject(client, &apiObjectOpts{path: "/things", create_id_header: "X-Missing"})
+		if err := object.create_object(); err == nil {
+			t.Errorf("api_object_test.go: Expected an error when the id header is missing")
+		}
+	})
+
+	/* Adopt the existing object when a create conflicts */
+	t.Run("on_conflict", func(t *testing.T) {
+		var updates []string
+
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things": func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "POST" {
+					http.Error(w, "already exists", http.StatusConflict)
+					return
+				}
+				w.Write([]byte(`{ "items": [{ "id": "x0", "name": "bar" }, { "id": "x1", "name": "foo" }] }`))
+			},
+			"/things/x1": func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "PUT" {
+					b, _ := ioutil.ReadAll(r.Body)
+					updates = append(updates, string(b))
+				}
+				w.Write([]byte(`{ "id": "x1", "name": "foo", "size": "small" }`))
+			},
+		}, nil)
+		defer svr.Close()
+
+		tests := []struct {
+			opts    *apiObjectOpts
+			fails   bool
+			updates int
+		}{
+			{&apiObjectOpts{path: "/things", data: `{ "name": "foo" }`, create_id_path: "id"}, true, 0},
+			{&apiObjectOpts{path: "/things", data: `{ "name": "foo" }`, create_id_path: "id", on_conflict: "adopt"}, true, 0},
+			{&apiObjectOpts{path: "/things", data: `{ "name": "foo", "size": "big" }`, create_id_path: "id", on_conflict: "adopt", conflict_search_key: "name", conflict_results_key: "items"}, false, 0},
+			{&apiObjectOpts{path: "/things", data: `{ "id": "x1", "size": "big" }`, on_conflict: "adopt_and_update"}, false, 1},
+		}
+		for i, test := range tests {
+			updates = nil
+			object, err := NewAPIObject(client, test.opts)
+			if err != nil {
+				t.Fatalf("api_object_test.go: %s", err)
+			}
+			err = object.create_object()
+			if test.fails {
+				if err == nil {
+					t.Errorf("api_object_test.go: Test %d: Expected create_object() to fail with the conflict", i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("api_object_test.go: Test %d: Failed to adopt the existing object: %s", i, err)
+			} else if object.id != "x1" || object.api_data["size"] != "small" || len(updates) != test.updates {
+				t.Errorf("api_object_test.go: Test %d: Expected to adopt x1 with %d updates, got '%s' (%v) with %v", i, test.updates, object.id, object.api_data, updates)
+			}
+		}
+
+		if _, err := NewAPIObject(client, &apiObjectOpts{path: "/things", id: "x1", on_conflict: "ignore"}); err == nil {
+			t.Errorf("api_object_test.go: Expected an error for an invalid on_conflict")
+		}
+	})
+
+	/* Read the object from a listing, with the method and headers of reads */
+	t.Run("read_search", func(t *testing.T) {
+		var listings int32
+
+		client, svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/things/search": func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&listings, 1)
+				if r.Method != "POST" || r.Header.Get("X-Read") != "yes" || r.URL.Query().Get("tenant") != "a" {
+					http.Error(w, "not a search", http.StatusBadRequest)
+					return
+				}
+				w.Write([]byte(`{ "items": [{ "id": "x0", "name": "bar" }, { "id": "x1", "name": "foo", "size": "small" }] }`))
+			},
+			"/things/bare": func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[{ "name": "baz" }]`))
+			},
+		}, nil)
+		defer svr.Close()
+
+		object, err := NewAPIObject(client, &apiObjectOpts{
+			path:         "/things",
+			search_path:  "/things/search",
+			id:           "x1",
+			read_method:  "POST",
+			read_headers: map[string]string{"X-Read": "yes"},
+			read_search: &readSearchOpt{
+				search_key:   "id",
+				results_key:  "items",
+				query_string: "tenant=a",
+			},
+		})
+		if err != nil {
+			t.Fatalf("api_object_test.go: %s", err)
+		}
+		if err := object.read_object(); err != nil {
+			t.Fatalf("api_object_test.go: Failed in read_object(): %s", err)
+		}
+		if n := atomic.LoadInt32(&listings); object.api_data["size"] != "small" || n != 1 {
+			t.Errorf("api_object_test.go: Expected the matched record in one request, got %v after %d", object.api_data, n)
+		}
+
+		object.id = "x2"
+		if err := object.read_object(); !object.is_not_found(err) {
+			t.Errorf("api_object_test.go: Expected a not found error for a missing record, got %v", err)
+		}
+
+		/* A matching record without an id does not clear the id */
+		object, _ = NewAPIObject(client, &apiObjectOpts{
+			path:        "/things",
+			search_path: "/things/bare",
+			id:          "x1",
+			read_search: &readSearchOpt{
+				search_key:   "name",
+				search_value: "baz",
+			},
+		})
+		if err := object.read_object(); err == nil || object.id != "x1" {
+			t.Errorf("api_object_test.go: Expected an error and the id 'x1' to be kept for a record without an id, got '%s' and %v", object.id, err)
+		}
+	})
 
 	if test_debug {
 		log.Println("api_object_test.go: Stopping HTTP server")
@@ -1,9 +1,12 @@
 package restapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
+	"io"
 	"log"
+	"strconv"
 	"strings"
 )
 
@@ -12,10 +15,93 @@ import (
    consume the values elsewhere if they'd like */
 func set_resource_state(obj *api_object, d *schema.ResourceData) {
 	api_data := make(map[string]string)
-	for k, v := range obj.api_data {
-		api_data[k] = fmt.Sprintf("%v", v)
+	if d.Get("flatten_api_data").(bool) {
+		flatten_api_data("", obj.api_data, api_data)
+	} else {
+		for k, v := range obj.api_data {
+			api_data[k] = fmt.Sprintf("%v", v)
+		}
 	}
 	d.Set("api_data", api_data)
+	d.Set("api_response", obj.api_response)
+}
+
+/* Adds the values in data to flat with keys such as
+   attrs.size or colors.0 for nested objects and arrays */
+func flatten_api_data(prefix string, data interface{}, flat map[string]string) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			flatten_api_data(prefix+k+".", child, flat)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten_api_data(fmt.Sprintf("%s%d.", prefix, i), child, flat)
+		}
+	case nil:
+		flat[strings.TrimSuffix(prefix, ".")] = ""
+	default:
+		flat[strings.TrimSuffix(prefix, ".")] = fmt.Sprintf("%v", v)
+	}
+}
+
+/* Reflects server-side changes to the fields the user manages
+   in data, so out-of-band edits show up in the plan and are
+   reverted by the next apply. data is only set when something
+   drifted so the user's formatting of the JSON is kept otherwise */
+func set_server_changes(obj *api_object, d *schema.ResourceData) error {
+	data_str := d.Get("data").(string)
+	if data_str == "" {
+		return nil
+	}
+
+	var data map[string]interface{}
+	if err := json_decode(data_str, &data); err != nil {
+		return err
+	}
+
+	ignore := make([]string, 0)
+	for _, v := range d.Get("ignore_server_changes").([]interface{}) {
+		ignore = append(ignore, v.(string))
+	}
+
+	if server_data, drifted := apply_server_changes(data, obj.api_data, ignore); drifted {
+		log.Printf("common.go: Object '%s' was changed outside of terraform. Updating data in the state.", obj.id)
+		b, err := json.Marshal(server_data)
+		if err != nil {
+			return err
+		}
+		d.Set("data", string(b))
+	}
+	return nil
+}
+
+/* Converts a TypeMap of strings as returned by d.Get
+   into a map of strings */
+func expand_string_map(v interface{}) map[string]string {
+	m := make(map[string]string)
+	if i_map, ok := v.(map[string]interface{}); ok {
+		for k, v := range i_map {
+			m[k] = v.(string)
+		}
+	}
+	return m
+}
+
+/* ValidateFunc for the *_method attributes. A method must be
+   a token as defined by RFC 7230, so typos like "PO ST" are
+   caught at plan time instead of when the request is built */
+func validate_http_method(v interface{}, k string) (ws []string, es []error) {
+	method := v.(string)
+	if method == "" {
+		return nil, []error{fmt.Errorf("%s cannot be empty", k)}
+	}
+	for _, c := range method {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return nil, []error{fmt.Errorf("%s is not a valid HTTP method: %q", k, method)}
+		}
+	}
+	return nil, nil
 }
 
 /* Using GetObjectAtKey, this function verifies the resulting
@@ -27,13 +113,32 @@ func GetStringAtKey(data map[string]interface{}, path string, debug bool) (strin
 	}
 
 	/* JSON supports strings, numbers, objects and arrays. Allow a string OR number here */
-	t := fmt.Sprintf("%T", res)
-	if t != "string" && t != "float64" {
-		return "", fmt.Errorf("Object at path '%s' is not a JSON string or number (float64). The go fmt package says it is '%T'", path, res)
+	switch v := res.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		/* Numbers decoded by json_decode keep the text they were sent as */
+		return v.String(), nil
+	case float64:
+		/* Without exponents, so large IDs don't come out as 1.2345e+18 */
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
 	}
+	return "", fmt.Errorf("Object at path '%s' is not a JSON string or number. The go fmt package says it is '%T'", path, res)
+}
 
-	/* Since it might be a number, coax it to a string with fmt */
-	return fmt.Sprintf("%v", res), nil
+/* Decodes JSON like json.Unmarshal, but keeps numbers as json.Number
+   instead of float64 so values such as 64-bit IDs are not rounded */
+func json_decode(data string, v interface{}) error {
+	d := json.NewDecoder(strings.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	/* Like json.Unmarshal, there must be nothing after the value */
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level JSON value")
+	}
+	return nil
 }
 
 /* Handy helper that will dig through a map and find something
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -47,6 +50,32 @@ func testAccCheckRestapiObjectExists(n string, id string, client *api_client) re
 	}
 }
 
+/* Starts a server answering the given routes and a client pointing at it.
+   opt.uri is used as a base path on the server, so it may be empty. The
+   caller must close the server when done */
+func new_test_client(t *testing.T, routes map[string]http.HandlerFunc, opt *apiClientOpt) (*api_client, *httptest.Server) {
+	serverMux := http.NewServeMux()
+	for pattern, handler := range routes {
+		serverMux.HandleFunc(pattern, handler)
+	}
+	svr := httptest.NewServer(serverMux)
+
+	if opt == nil {
+		opt = &apiClientOpt{}
+	}
+	opt.uri = svr.URL + opt.uri
+	if opt.timeout == 0 {
+		opt.timeout = 2
+	}
+
+	client, err := NewAPIClient(opt)
+	if err != nil {
+		svr.Close()
+		t.Fatalf("common_test.go: Failed to create the test client: %s", err)
+	}
+	return client, svr
+}
+
 func TestGetStringAtKey(t *testing.T) {
 	debug := false
 	test_obj := make(map[string]interface{})
@@ -154,3 +183,77 @@ func TestGetListStringAtKey(t *testing.T) {
 		t.Fatalf("Error: Expected '2', but got %s", res)
 	}
 }
+
+func TestFlattenAPIData(t *testing.T) {
+	test_obj := make(map[string]interface{})
+	err := json.Unmarshal([]byte(`
+    {
+      "id": 1,
+      "attrs": { "size": "6 in", "empty": null },
+      "colors": ["orange", "white"],
+      "items": [{ "id": "3333" }]
+    }
+  `), &test_obj)
+	if nil != err {
+		t.Fatalf("Error unmarshalling JSON: %s", err)
+	}
+
+	flat := make(map[string]string)
+	flatten_api_data("", test_obj, flat)
+
+	expected := map[string]string{
+		"id":          "1",
+		"attrs.size":  "6 in",
+		"attrs.empty": "",
+		"colors.0":    "orange",
+		"colors.1":    "white",
+		"items.0.id":  "3333",
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Fatalf("Error: Expected %v, but got %v", expected, flat)
+	}
+}
+
+func TestJSONDecodeKeepsPrecision(t *testing.T) {
+	test_obj := make(map[string]interface{})
+	if err := json_decode(`{ "id": 9007199254740993, "big": 1234500000000000000, "ratio": 0.25 }`, &test_obj); err != nil {
+		t.Fatalf("Error decoding JSON: %s", err)
+	}
+
+	expected := map[string]string{
+		"id":    "9007199254740993",
+		"big":   "1234500000000000000",
+		"ratio": "0.25",
+	}
+	for key, value := range expected {
+		res, err := GetStringAtKey(test_obj, key, false)
+		if err != nil {
+			t.Fatalf("Error extracting '%s' from JSON payload: %s", key, err)
+		} else if value != res {
+			t.Fatalf("Error: Expected '%s', but got %s", value, res)
+		}
+	}
+
+	/* Values that did not come from json_decode are not printed with exponents */
+	res, _ := GetStringAtKey(map[string]interface{}{"big": float64(1234500000000000000)}, "big", false)
+	if res != "1234500000000000000" {
+		t.Fatalf("Error: Expected '1234500000000000000', but got %s", res)
+	}
+
+	if err := json_decode(`{ "id": 1 } trailing`, &test_obj); err == nil {
+		t.Fatalf("Error expected when decoding JSON with trailing data")
+	}
+}
+
+func TestValidateHTTPMethod(t *testing.T) {
+	for _, method := range []string{"GET", "PATCH", "PROPFIND", "M-SEARCH"} {
+		if _, es := validate_http_method(method, "create_method"); len(es) != 0 {
+			t.Errorf("Error: Expected '%s' to be valid, but got %v", method, es)
+		}
+	}
+	for _, method := range []string{"", "PO ST", "GET\n", "GET/1"} {
+		if _, es := validate_http_method(method, "create_method"); len(es) == 0 {
+			t.Errorf("Error: Expected '%s' to be invalid", method)
+		}
+	}
+}
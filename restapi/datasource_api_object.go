@@ -20,6 +20,18 @@ func dataSourceRestApi() *schema.Resource {
 				Description: "An optional query string to send when performing the search.",
 				Optional:    true,
 			},
+			"headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "A map of header names and values to set on the requests of this data source. They are set over the `headers` of the provider.",
+				Optional:    true,
+			},
+			"query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "A map of query parameter names and values to add to the requests of this data source, along with `query_string` when searching. Values are escaped.",
+				Optional:    true,
+			},
 			"search_key": &schema.Schema{
 				Type:        schema.TypeString,
 				Description: "When reading search results from the API, this key is used to identify the specific record to read. This should be a unique record such as 'name'. Similar to results_key, the value may be in the format of 'field/field/field' to search for data deeper in the returned object.",
@@ -45,6 +57,16 @@ func dataSourceRestApi() *schema.Resource {
 				Description: "Whether to emit verbose debug output while working with the API object on the server.",
 				Optional:    true,
 			},
+			"flatten_api_data": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "Flatten nested objects and arrays in `api_data` into keys such as `attrs.size` or `colors.0` instead of using the golang fmt package's representation of them.",
+				Optional:    true,
+			},
+			"api_response": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "The raw JSON of the object as returned by the API server. Use `jsondecode` to access nested values.",
+				Computed:    true,
+			},
 			"api_data": &schema.Schema{
 				Type:        schema.TypeMap,
 				Elem:        &schema.Schema{Type: schema.TypeString},
@@ -78,6 +100,8 @@ func dataSourceRestApiRead(d *schema.ResourceData, meta interface{}) error {
 		path:         path,
 		debug:        debug,
 		id_attribute: id_attribute,
+		headers:      expand_string_map(d.Get("headers")),
+		query_params: expand_string_map(d.Get("query_params")),
 	}
 
 	obj, err := NewAPIObject(client, opts)
@@ -85,6 +109,8 @@ func dataSourceRestApiRead(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
+	/* find_object keeps the matching record, but the search results
+	   may not hold the whole object, so it is still read below */
 	if err := obj.find_object(query_string, search_key, search_value, results_key); err != nil {
 		return err
 	}
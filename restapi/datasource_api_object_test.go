@@ -122,6 +122,7 @@ func TestAccRestapiobject_Basic(t *testing.T) {
                path = "/api/objects"
                search_key = "data/identifier"
                search_value = "NestedFields"
+               flatten_api_data = true
                debug = %t
             }
           `, debug),
@@ -130,6 +131,8 @@ func TestAccRestapiobject_Basic(t *testing.T) {
 					resource.TestCheckResourceAttr("data.restapi_object.Nested", "id", "5678"),
 					resource.TestCheckResourceAttr("data.restapi_object.Nested", "api_data.first", "Nested"),
 					resource.TestCheckResourceAttr("data.restapi_object.Nested", "api_data.last", "Fields"),
+					resource.TestCheckResourceAttr("data.restapi_object.Nested", "api_data.data.identifier", "NestedFields"),
+					resource.TestCheckResourceAttrSet("data.restapi_object.Nested", "api_response"),
 				),
 			},
 			{
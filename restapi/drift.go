@@ -0,0 +1,67 @@
+package restapi
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/* Returns a copy of data where every value managed by the user
+   that the server reports differently is replaced with the value
+   from the server, and whether there was any such difference.
+   Keys the server does not return (such as write-only secrets)
+   and paths in ignore (in the format 'field/field') are left as-is */
+func apply_server_changes(data map[string]interface{}, api_data map[string]interface{}, ignore []string) (map[string]interface{}, bool) {
+	return apply_server_changes_at("", data, api_data, ignore)
+}
+
+func apply_server_changes_at(prefix string, data map[string]interface{}, api_data map[string]interface{}, ignore []string) (map[string]interface{}, bool) {
+	result := make(map[string]interface{}, len(data))
+	drifted := false
+
+	for k, v := range data {
+		result[k] = v
+
+		path := prefix + k
+		if contains_string(ignore, path) {
+			continue
+		}
+		api_v, ok := api_data[k]
+		if !ok {
+			continue
+		}
+
+		var changed bool
+		result[k], changed = apply_server_value(path, v, api_v, ignore)
+		drifted = drifted || changed
+	}
+
+	return result, drifted
+}
+
+/* Objects are compared key by key and arrays of the same length
+   element by element, so fields the server adds inside them are
+   not drift. Anything else that differs is taken from the server */
+func apply_server_value(path string, v interface{}, api_v interface{}, ignore []string) (interface{}, bool) {
+	if reflect.DeepEqual(v, api_v) {
+		return v, false
+	}
+
+	switch data_v := v.(type) {
+	case map[string]interface{}:
+		if api_map, ok := api_v.(map[string]interface{}); ok {
+			return apply_server_changes_at(path+"/", data_v, api_map, ignore)
+		}
+	case []interface{}:
+		if api_array, ok := api_v.([]interface{}); ok && len(api_array) == len(data_v) {
+			result := make([]interface{}, len(data_v))
+			drifted := false
+			for i := range data_v {
+				var changed bool
+				result[i], changed = apply_server_value(fmt.Sprintf("%s/%d", path, i), data_v[i], api_array[i], ignore)
+				drifted = drifted || changed
+			}
+			return result, drifted
+		}
+	}
+	return api_v, true
+}
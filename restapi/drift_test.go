@@ -0,0 +1,38 @@
+package restapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyServerChanges(t *testing.T) {
+	tests := []struct {
+		data     string
+		api_data string
+		ignore   []string
+		expected string
+		drifted  bool
+	}{
+		{`{"a": 1, "b": {"c": "x"}}`, `{"a": 1, "b": {"c": "x", "d": "y"}, "e": 2}`, nil, `{"a": 1, "b": {"c": "x"}}`, false},
+		{`{"a": 1, "b": {"c": "x"}}`, `{"a": 2, "b": {"c": "z"}}`, nil, `{"a": 2, "b": {"c": "z"}}`, true},
+		{`{"a": 1, "b": {"c": "x"}}`, `{"a": 1, "b": {"c": "z"}}`, []string{"b/c"}, `{"a": 1, "b": {"c": "x"}}`, false},
+		{`{"a": [1, 2], "password": "secret"}`, `{"a": [2, 1]}`, nil, `{"a": [2, 1], "password": "secret"}`, true},
+		{`{"rules": [{"port": 80}]}`, `{"rules": [{"port": 80, "rule_id": "r1"}]}`, nil, `{"rules": [{"port": 80}]}`, false},
+		{`{"rules": [{"port": 80}, {"port": 443}]}`, `{"rules": [{"port": 80, "rule_id": "r1"}, {"port": 8443, "rule_id": "r2"}]}`, nil, `{"rules": [{"port": 80}, {"port": 8443}]}`, true},
+		{`{"rules": [{"port": 80}]}`, `{"rules": [{"port": 81, "rule_id": "r1"}]}`, []string{"rules/0/port"}, `{"rules": [{"port": 80}]}`, false},
+		{`{"rules": [{"port": 80}]}`, `{"rules": [{"port": 80}, {"port": 443}]}`, nil, `{"rules": [{"port": 80}, {"port": 443}]}`, true},
+	}
+
+	for _, test := range tests {
+		var data, api_data, expected map[string]interface{}
+		json.Unmarshal([]byte(test.data), &data)
+		json.Unmarshal([]byte(test.api_data), &api_data)
+		json.Unmarshal([]byte(test.expected), &expected)
+
+		result, drifted := apply_server_changes(data, api_data, test.ignore)
+		if drifted != test.drifted || !reflect.DeepEqual(result, expected) {
+			t.Errorf("drift_test.go: data %s and api_data %s (ignoring %v): expected %v (drifted=%t), got %v (drifted=%t)", test.data, test.api_data, test.ignore, expected, test.drifted, result, drifted)
+		}
+	}
+}
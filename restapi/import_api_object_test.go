@@ -1,10 +1,13 @@
 package restapi
 
 import (
+	"fmt"
 	"github.com/Mastercard/terraform-provider-restapi/fakeserver"
 	mylog "github.com/Mastercard/terraform-provider-restapi/log"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -60,8 +63,54 @@ func TestAccRestApiObject_importBasic(t *testing.T) {
 				ImportStateVerify:       true,
 				ImportStateVerifyIgnore: []string{"debug", "data"},
 			},
+			{
+				ResourceName:            "restapi_object.Foo",
+				ImportState:             true,
+				ImportStateId:           `{ "path": "/api/objects", "id": "1234", "id_attribute": "id" }`,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"debug", "data", "id_attribute"},
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					if !json_equivalent(states[0].Attributes["data"], `{ "id": "1234", "first": "Foo", "last": "Bar" }`, nil) {
+						return fmt.Errorf("Expected data to be the object on the server, got '%s'", states[0].Attributes["data"])
+					}
+					return nil
+				},
+			},
+			{
+				/* Find the id by searching, like the data source */
+				ResourceName:            "restapi_object.Foo",
+				ImportState:             true,
+				ImportStateId:           "path=/api/objects,search_key=last,search_value=Bar",
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"debug", "data"},
+			},
 		},
 	})
 
 	svr.Shutdown()
 }
+
+func TestParseImportID(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"/api/objects/1234":                                       {"path": "/api/objects", "id": "1234"},
+		"path=/api/objects, id=1234,read_path=/x/{id}":            {"path": "/api/objects", "id": "1234", "read_path": "/x/{id}"},
+		`{ "path": "/api/objects", "id": "1234", "debug": true }`: {"path": "/api/objects", "id": "1234", "debug": true},
+		"path=/api/users,search_key=email,search_value=a@b.c":     {"path": "/api/users", "search_key": "email", "search_value": "a@b.c"},
+		"/v1/name=foo/123":                                        {"path": "/v1/name=foo", "id": "123"},
+		"/v1/things/a=b,c=d":                                      {"path": "/v1/things", "id": "a=b,c=d"},
+	}
+	for input, expected := range tests {
+		settings, err := parse_import_id(input)
+		if err != nil {
+			t.Errorf("import_api_object_test.go: Failed to parse '%s': %s", input, err)
+		} else if !reflect.DeepEqual(settings, expected) {
+			t.Errorf("import_api_object_test.go: Expected '%s' to parse to %v, got %v", input, expected, settings)
+		}
+	}
+
+	for _, input := range []string{"1234", "name=foo", "{ not json"} {
+		if _, err := parse_import_id(input); err == nil {
+			t.Errorf("import_api_object_test.go: Expected an error parsing '%s'", input)
+		}
+	}
+}
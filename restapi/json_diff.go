@@ -0,0 +1,89 @@
+package restapi
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+/* Whether two JSON documents hold the same data, regardless of
+   formatting, key order or how numbers are written (1.0 and 1).
+   The order of the arrays at unordered_paths (in the format
+   'field/field') is not significant */
+func json_equivalent(a string, b string, unordered_paths []string) bool {
+	var a_data, b_data interface{}
+	if err := json_decode(a, &a_data); err != nil {
+		return false
+	}
+	if err := json_decode(b, &b_data); err != nil {
+		return false
+	}
+	a_data = canonical_numbers(a_data)
+	b_data = canonical_numbers(b_data)
+
+	for _, path := range unordered_paths {
+		sort_array_at(a_data, path)
+		sort_array_at(b_data, path)
+	}
+	return reflect.DeepEqual(a_data, b_data)
+}
+
+/* A number written in its exact, canonical form */
+type canonical_number string
+
+/* Replaces every json.Number in data with its canonical_number,
+   so 1, 1.0 and 1e0 compare equal without losing precision */
+func canonical_numbers(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = canonical_numbers(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = canonical_numbers(child)
+		}
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(v.String()); ok {
+			return canonical_number(r.RatString())
+		}
+		return canonical_number(v.String())
+	}
+	return data
+}
+
+/* Sorts the array at path in place by the JSON of its elements */
+func sort_array_at(data interface{}, path string) {
+	hash, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	value, err := GetObjectAtKey(hash, path, false)
+	if err != nil {
+		return
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return
+	}
+
+	keys := make([]string, len(array))
+	for i, v := range array {
+		b, _ := json.Marshal(v)
+		keys[i] = string(b)
+	}
+	sort.Sort(&array_by_key{array: array, keys: keys})
+}
+
+type array_by_key struct {
+	array []interface{}
+	keys  []string
+}
+
+func (s *array_by_key) Len() int           { return len(s.array) }
+func (s *array_by_key) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s *array_by_key) Swap(i, j int) {
+	s.array[i], s.array[j] = s.array[j], s.array[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
@@ -0,0 +1,31 @@
+package restapi
+
+import (
+	"testing"
+)
+
+func TestJSONEquivalent(t *testing.T) {
+	tests := []struct {
+		a         string
+		b         string
+		unordered []string
+		expected  bool
+	}{
+		{`{"a": 1, "b": "x"}`, "{\n  \"b\": \"x\",\n  \"a\": 1.0\n}", nil, true},
+		{`{"a": 1}`, `{"a": 2}`, nil, false},
+		{`{"a": [1, 2]}`, `{"a": [2, 1]}`, nil, false},
+		{`{"a": [1, 2]}`, `{"a": [2, 1]}`, []string{"a"}, true},
+		{`{"a": {"b": [{"x": 1}, {"y": 2}]}}`, `{"a": {"b": [{"y": 2}, {"x": 1.0}]}}`, []string{"a/b"}, true},
+		{`{"a": [1, 2]}`, `{"a": [2, 2]}`, []string{"a"}, false},
+		{`{"id": 9007199254740993}`, `{"id": 9007199254740992}`, nil, false},
+		{`{"a": 100, "b": 0.5}`, `{"a": 1e2, "b": 0.50}`, nil, true},
+		{`{"a": 1}`, `{"a": "1"}`, nil, false},
+		{`{"a": 1}`, `not json`, nil, false},
+	}
+
+	for _, test := range tests {
+		if json_equivalent(test.a, test.b, test.unordered) != test.expected {
+			t.Errorf("json_diff_test.go: Expected json_equivalent(%s, %s, %v) to be %t", test.a, test.b, test.unordered, test.expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package restapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/* Build an RFC 7396 JSON merge patch that turns old into new:
+   removed keys are set to null, changed objects are diffed
+   recursively and any other changed value is sent as-is */
+func merge_patch(old_data map[string]interface{}, new_data map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+
+	for k := range old_data {
+		if _, ok := new_data[k]; !ok {
+			patch[k] = nil
+		}
+	}
+
+	for k, new_v := range new_data {
+		old_v, ok := old_data[k]
+		if ok && reflect.DeepEqual(old_v, new_v) {
+			continue
+		}
+
+		old_map, old_is_map := old_v.(map[string]interface{})
+		new_map, new_is_map := new_v.(map[string]interface{})
+		if ok && old_is_map && new_is_map {
+			patch[k] = merge_patch(old_map, new_map)
+		} else {
+			patch[k] = new_v
+		}
+	}
+
+	return patch
+}
+
+/* Build an RFC 6902 JSON patch that turns old into new. Objects are
+   diffed key by key, arrays and other values are replaced whole */
+func json_patch(old_data map[string]interface{}, new_data map[string]interface{}) []map[string]interface{} {
+	return append_json_patch(make([]map[string]interface{}, 0), "", old_data, new_data)
+}
+
+func append_json_patch(ops []map[string]interface{}, prefix string, old_data map[string]interface{}, new_data map[string]interface{}) []map[string]interface{} {
+	/* Sorted so the same change always produces the same patch */
+	for _, k := range sorted_keys(old_data) {
+		if _, ok := new_data[k]; !ok {
+			ops = append(ops, map[string]interface{}{"op": "remove", "path": prefix + "/" + json_pointer_escape(k)})
+		}
+	}
+
+	for _, k := range sorted_keys(new_data) {
+		path := prefix + "/" + json_pointer_escape(k)
+		new_v := new_data[k]
+		old_v, ok := old_data[k]
+
+		if !ok {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": path, "value": new_v})
+			continue
+		}
+		if reflect.DeepEqual(old_v, new_v) {
+			continue
+		}
+
+		old_map, old_is_map := old_v.(map[string]interface{})
+		new_map, new_is_map := new_v.(map[string]interface{})
+		if old_is_map && new_is_map {
+			ops = append_json_patch(ops, path, old_map, new_map)
+		} else {
+			ops = append(ops, map[string]interface{}{"op": "replace", "path": path, "value": new_v})
+		}
+	}
+
+	return ops
+}
+
+/* Turn a 'field/field' key into a JSON pointer (RFC 6901) */
+func json_pointer(key string) string {
+	if key == "" {
+		return ""
+	}
+	pointer := ""
+	for _, part := range strings.Split(key, "/") {
+		pointer += "/" + json_pointer_escape(part)
+	}
+	return pointer
+}
+
+/* Escape a key for use in a JSON pointer (RFC 6901) */
+func json_pointer_escape(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+func sorted_keys(hash map[string]interface{}) []string {
+	keys := GetKeys(hash)
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,56 @@
+package restapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var patch_old_data = `{
+  "name": "foo",
+  "size": 1,
+  "tags": ["a", "b"],
+  "owner": { "name": "bar", "email": "bar@example.com" },
+  "a/b": "slash",
+  "gone": true
+}`
+
+var patch_new_data = `{
+  "name": "foo",
+  "size": 2,
+  "tags": ["a"],
+  "owner": { "name": "baz", "email": "bar@example.com" },
+  "a/b": "slash",
+  "added": "new"
+}`
+
+func TestMergePatch(t *testing.T) {
+	var old_data, new_data map[string]interface{}
+	json.Unmarshal([]byte(patch_old_data), &old_data)
+	json.Unmarshal([]byte(patch_new_data), &new_data)
+
+	b, _ := json.Marshal(merge_patch(old_data, new_data))
+	expected := `{"added":"new","gone":null,"owner":{"name":"baz"},"size":2,"tags":["a"]}`
+	if string(b) != expected {
+		t.Fatalf("patch_test.go: Expected merge patch '%s' but got '%s'", expected, string(b))
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	var old_data, new_data map[string]interface{}
+	json.Unmarshal([]byte(patch_old_data), &old_data)
+	json.Unmarshal([]byte(patch_new_data), &new_data)
+
+	b, _ := json.Marshal(json_patch(old_data, new_data))
+	expected := `[{"op":"remove","path":"/gone"},` +
+		`{"op":"add","path":"/added","value":"new"},` +
+		`{"op":"replace","path":"/owner/name","value":"baz"},` +
+		`{"op":"replace","path":"/size","value":2},` +
+		`{"op":"replace","path":"/tags","value":["a"]}]`
+	if string(b) != expected {
+		t.Fatalf("patch_test.go: Expected JSON patch '%s' but got '%s'", expected, string(b))
+	}
+
+	if json_pointer_escape("a/b~c") != "a~1b~0c" {
+		t.Fatalf("patch_test.go: JSON pointer escaping of 'a/b~c' gave '%s'", json_pointer_escape("a/b~c"))
+	}
+}
@@ -1,8 +1,10 @@
 package restapi
 
 import (
+	"errors"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
+	"net/url"
 )
 
 func Provider() terraform.ResourceProvider {
@@ -81,6 +83,253 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("REST_API_XSSI_PREFIX", nil),
 				Description: "Trim the xssi prefix from response string, if present, before parsing.",
 			},
+			"response_object_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RESPONSE_OBJECT_KEY", nil),
+				Description: "When set, the object is read from this key of the responses to reads and writes, for APIs that wrap objects in an envelope such as `{\"data\": {...}, \"meta\": {...}}`. The format is 'field/field/field'. Can be overridden on each `restapi_object`.",
+			},
+			"request_wrapper_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_REQUEST_WRAPPER_KEY", nil),
+				Description: "When set, the data sent on creates and updates is wrapped in an object under this key. The format is 'field/field/field'. Can be overridden on each `restapi_object`.",
+			},
+			"create_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("REST_API_CREATE_METHOD", "POST"),
+				Description:  "The HTTP method used to CREATE objects of any type. Can be overridden on each `restapi_object`.",
+				ValidateFunc: validate_http_method,
+			},
+			"read_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("REST_API_READ_METHOD", "GET"),
+				Description:  "The HTTP method used to READ objects of any type. Can be overridden on each `restapi_object`.",
+				ValidateFunc: validate_http_method,
+			},
+			"update_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("REST_API_UPDATE_METHOD", "PUT"),
+				Description:  "The HTTP method used to UPDATE objects of any type. Can be overridden on each `restapi_object`.",
+				ValidateFunc: validate_http_method,
+			},
+			"destroy_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("REST_API_DESTROY_METHOD", "DELETE"),
+				Description:  "The HTTP method used to DESTROY objects of any type. Can be overridden on each `restapi_object`.",
+				ValidateFunc: validate_http_method,
+			},
+			"max_redirects": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_REDIRECTS", 5),
+				Description: "The maximum number of redirects (301, 302, 303, 307, 308) to follow for a single request. Set to 0 to treat any redirect as an error.",
+			},
+			"allow_cross_host_redirects": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_ALLOW_CROSS_HOST_REDIRECTS", nil),
+				Description: "By default, a redirect to a different host is refused when the request carries an Authorization header (from `headers` or `username`/`password`) so credentials are not leaked. Other redirects to a different host are followed without the cookies and the `login` session header. Set this to follow such redirects with all headers anyway.",
+			},
+			"retry_max": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_MAX", 0),
+				Description: "How many times to retry a request that failed with a connection error or one of the `retry_status_codes`. Defaults to 0 (no retries).",
+			},
+			"retry_backoff_base_ms": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_BACKOFF_BASE_MS", 500),
+				Description: "The wait (in milliseconds) before the first retry. Each following retry doubles the wait, up to `retry_backoff_max_ms`. A `Retry-After` header sent by the server takes precedence.",
+			},
+			"retry_backoff_max_ms": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_BACKOFF_MAX_MS", 30000),
+				Description: "The longest wait (in milliseconds) between two retries.",
+			},
+			"retry_jitter": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_JITTER", true),
+				Description: "Randomize the wait between retries (between half and all of the computed backoff) so parallel requests do not retry in lockstep.",
+			},
+			"retry_status_codes": &schema.Schema{
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Optional:    true,
+				Description: "The HTTP response codes that will be retried. Defaults to `[429, 502, 503, 504]`.",
+			},
+			"retry_non_idempotent": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RETRY_NON_IDEMPOTENT", nil),
+				Description: "Also retry POST and PATCH requests. These are not retried by default since the server may have applied them before failing.",
+			},
+			"rate_limit": &schema.Schema{
+				Type:        schema.TypeFloat,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RATE_LIMIT", 0.0),
+				Description: "Limit the number of requests sent to the API per second across all resources and data sources. Defaults to 0 (unlimited).",
+			},
+			"rate_limit_burst": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_RATE_LIMIT_BURST", 1),
+				Description: "When `rate_limit` is set, how many requests may be sent at once before the rate applies.",
+			},
+			"max_concurrent_requests": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_MAX_CONCURRENT_REQUESTS", 0),
+				Description: "Limit the number of requests in flight to the API at any time, regardless of terraform's parallelism. Login requests count against the limit, requests waiting to be retried do not. Defaults to 0 (unlimited).",
+			},
+			"oauth_client_credentials": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Configuration for the OAuth2 client credentials flow. The token is fetched before the first request, cached, refreshed before it expires and sent as a Bearer token in the Authorization header.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"oauth_client_id": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The OAuth client ID.",
+						},
+						"oauth_client_secret": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Sensitive:   true,
+							Description: "The OAuth client secret.",
+						},
+						"oauth_token_endpoint": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The OAuth token endpoint (full URL) used to request tokens.",
+						},
+						"oauth_scopes": &schema.Schema{
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "The scopes to request with the token.",
+						},
+						"endpoint_params": &schema.Schema{
+							Type:        schema.TypeMap,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "Additional key/value pairs to send to the token endpoint, such as `audience`.",
+						},
+					},
+				},
+			},
+			"ca_cert_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_CA_CERT_FILE", nil),
+				Description: "When using https, a file with PEM encoded CA certificates to trust in addition to the system roots.",
+			},
+			"ca_cert_pem": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "When using https, PEM encoded CA certificates to trust in addition to the system roots.",
+			},
+			"client_cert_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("REST_API_CLIENT_CERT_FILE", nil),
+				ConflictsWith: []string{"client_cert_pem"},
+				Description:   "When using https, a file with the PEM encoded client certificate to present to the server. Requires `client_key_file` or `client_key_pem`.",
+			},
+			"client_key_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("REST_API_CLIENT_KEY_FILE", nil),
+				ConflictsWith: []string{"client_key_pem"},
+				Description:   "When using https, a file with the PEM encoded private key of the client certificate.",
+			},
+			"client_cert_pem": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"client_cert_file"},
+				Description:   "When using https, the PEM encoded client certificate to present to the server. Requires `client_key_file` or `client_key_pem`.",
+			},
+			"client_key_pem": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"client_key_file"},
+				Description:   "When using https, the PEM encoded private key of the client certificate.",
+			},
+			"tls_min_version": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_TLS_MIN_VERSION", nil),
+				Description: "When using https, the minimum TLS version to accept. One of `1.0`, `1.1`, `1.2` or `1.3`.",
+			},
+			"tls_server_name": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("REST_API_TLS_SERVER_NAME", nil),
+				Description: "When using https, verify the server certificate against this name (and send it as SNI) instead of the host in `uri`.",
+			},
+			"login": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Log in to the API before the first request and send the returned session token with every request. When the API answers 401, the provider logs in again and repeats the request once.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The API path of the login endpoint on top of the base URL.",
+						},
+						"method": &schema.Schema{
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "POST",
+							Description:  "The HTTP method used to log in.",
+							ValidateFunc: validate_http_method,
+						},
+						"body": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Valid JSON data (such as the credentials) to send to the login endpoint.",
+						},
+						"token_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Where to find the token in the JSON response of the login endpoint. The format is 'field/field/field'.",
+						},
+						"token_header": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The response header of the login endpoint that holds the token.",
+						},
+						"header_name": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The request header used to send the token. Defaults to `Authorization` unless `cookie_name` is set.",
+						},
+						"header_value": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The value of `header_name`. The string `{token}` is replaced with the token. Defaults to `Bearer {token}`.",
+						},
+						"cookie_name": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Send the token as a cookie with this name instead of a header.",
+						},
+					},
+				},
+			},
 			"debug": &schema.Schema{
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -119,20 +368,93 @@ func configureProvider(d *schema.ResourceData) (interface{}, error) {
 		}
 	}
 
+	retry_status_codes := make([]int, 0)
+	if i_retry_status_codes := d.Get("retry_status_codes"); i_retry_status_codes != nil {
+		for _, v := range i_retry_status_codes.([]interface{}) {
+			retry_status_codes = append(retry_status_codes, v.(int))
+		}
+	}
+
+	/* For the client, 0 means the default and a negative value
+	   means no redirects at all */
+	max_redirects := d.Get("max_redirects").(int)
+	if max_redirects < 0 {
+		return nil, errors.New("max_redirects cannot be negative")
+	} else if max_redirects == 0 {
+		max_redirects = -1
+	}
+
 	opt := &apiClientOpt{
-		uri:                   d.Get("uri").(string),
-		insecure:              d.Get("insecure").(bool),
-		username:              d.Get("username").(string),
-		password:              d.Get("password").(string),
-		headers:               headers,
-		use_cookie:            d.Get("use_cookies").(bool),
-		timeout:               d.Get("timeout").(int),
-		id_attribute:          d.Get("id_attribute").(string),
-		copy_keys:             copy_keys,
-		write_returns_object:  d.Get("write_returns_object").(bool),
-		create_returns_object: d.Get("create_returns_object").(bool),
-		xssi_prefix:           d.Get("xssi_prefix").(string),
-		debug:                 d.Get("debug").(bool),
+		uri:                        d.Get("uri").(string),
+		insecure:                   d.Get("insecure").(bool),
+		username:                   d.Get("username").(string),
+		password:                   d.Get("password").(string),
+		headers:                    headers,
+		use_cookies:                d.Get("use_cookies").(bool),
+		timeout:                    d.Get("timeout").(int),
+		id_attribute:               d.Get("id_attribute").(string),
+		copy_keys:                  copy_keys,
+		write_returns_object:       d.Get("write_returns_object").(bool),
+		create_returns_object:      d.Get("create_returns_object").(bool),
+		xssi_prefix:                d.Get("xssi_prefix").(string),
+		response_object_key:        d.Get("response_object_key").(string),
+		request_wrapper_key:        d.Get("request_wrapper_key").(string),
+		create_method:              d.Get("create_method").(string),
+		read_method:                d.Get("read_method").(string),
+		update_method:              d.Get("update_method").(string),
+		destroy_method:             d.Get("destroy_method").(string),
+		max_redirects:              max_redirects,
+		allow_cross_host_redirects: d.Get("allow_cross_host_redirects").(bool),
+		retry_max:                  d.Get("retry_max").(int),
+		retry_backoff_base_ms:      d.Get("retry_backoff_base_ms").(int),
+		retry_backoff_max_ms:       d.Get("retry_backoff_max_ms").(int),
+		retry_jitter:               d.Get("retry_jitter").(bool),
+		retry_status_codes:         retry_status_codes,
+		retry_non_idempotent:       d.Get("retry_non_idempotent").(bool),
+		rate_limit:                 d.Get("rate_limit").(float64),
+		rate_limit_burst:           d.Get("rate_limit_burst").(int),
+		max_concurrent_requests:    d.Get("max_concurrent_requests").(int),
+		ca_cert_file:               d.Get("ca_cert_file").(string),
+		ca_cert_pem:                d.Get("ca_cert_pem").(string),
+		client_cert_file:           d.Get("client_cert_file").(string),
+		client_key_file:            d.Get("client_key_file").(string),
+		client_cert_pem:            d.Get("client_cert_pem").(string),
+		client_key_pem:             d.Get("client_key_pem").(string),
+		tls_min_version:            d.Get("tls_min_version").(string),
+		tls_server_name:            d.Get("tls_server_name").(string),
+		debug:                      d.Get("debug").(bool),
+	}
+
+	if v, ok := d.GetOk("oauth_client_credentials"); ok {
+		oauth_config := v.([]interface{})[0].(map[string]interface{})
+
+		opt.oauth_client_id = oauth_config["oauth_client_id"].(string)
+		opt.oauth_client_secret = oauth_config["oauth_client_secret"].(string)
+		opt.oauth_token_endpoint = oauth_config["oauth_token_endpoint"].(string)
+
+		for _, v := range oauth_config["oauth_scopes"].([]interface{}) {
+			opt.oauth_scopes = append(opt.oauth_scopes, v.(string))
+		}
+
+		opt.oauth_endpoint_params = make(url.Values)
+		for k, v := range oauth_config["endpoint_params"].(map[string]interface{}) {
+			opt.oauth_endpoint_params.Set(k, v.(string))
+		}
+	}
+
+	if v, ok := d.GetOk("login"); ok {
+		login_config := v.([]interface{})[0].(map[string]interface{})
+
+		opt.login = &loginOpt{
+			path:         login_config["path"].(string),
+			method:       login_config["method"].(string),
+			body:         login_config["body"].(string),
+			token_key:    login_config["token_key"].(string),
+			token_header: login_config["token_header"].(string),
+			header_name:  login_config["header_name"].(string),
+			header_value: login_config["header_value"].(string),
+			cookie_name:  login_config["cookie_name"].(string),
+		}
 	}
 
 	client, err := NewAPIClient(opt)
@@ -0,0 +1,55 @@
+package restapi
+
+import (
+	"sync"
+	"time"
+)
+
+/* A simple token bucket shared by every request an api_client
+   sends. Tokens refill at `rate` per second up to `burst`. Callers
+   that find the bucket empty reserve a future token and sleep until
+   it is due, so waiting requests are released in order */
+type rate_limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func new_rate_limiter(rate float64, burst int) *rate_limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rate_limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+/* Block until the caller is allowed to send a request.
+   A nil rate_limiter never blocks */
+func (l *rate_limiter) wait() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
@@ -0,0 +1,127 @@
+package restapi
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	/* A nil limiter is what clients without rate_limit get */
+	var unlimited *rate_limiter
+	unlimited.wait()
+
+	limiter := new_rate_limiter(20, 2)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.wait()
+		}()
+	}
+	wg.Wait()
+
+	/* Two requests go out right away from the burst, the other
+	   four have to wait 50ms each */
+	elapsed := time.Since(start)
+	if elapsed < 190*time.Millisecond {
+		t.Fatalf("rate_limiter_test.go: 6 requests at 20/s with a burst of 2 took %s, expected at least 200ms", elapsed)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("rate_limiter_test.go: 6 requests at 20/s with a burst of 2 took %s, expected about 200ms", elapsed)
+	}
+}
+
+func TestAPIClientLimits(t *testing.T) {
+	var in_flight, max_in_flight, throttled int32
+
+	client, svr := new_test_client(t, map[string]http.HandlerFunc{
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&in_flight, 1)
+			defer atomic.AddInt32(&in_flight, -1)
+			for {
+				max := atomic.LoadInt32(&max_in_flight)
+				if n <= max || atomic.CompareAndSwapInt32(&max_in_flight, max, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		},
+		"/throttled": func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&throttled, 1) <= 2 {
+				http.Error(w, "Slow down", http.StatusTooManyRequests)
+			}
+		},
+		"/ok": func(w http.ResponseWriter, r *http.Request) {},
+	}, &apiClientOpt{
+		max_concurrent_requests: 2,
+		retry_max:               1,
+		retry_backoff_base_ms:   300,
+		retry_backoff_max_ms:    300,
+	})
+	defer svr.Close()
+
+	t.Run("max_concurrent_requests", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := client.send_request("GET", "/slow", ""); err != nil {
+					t.Errorf("rate_limiter_test.go: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&max_in_flight); n != 2 {
+			t.Fatalf("rate_limiter_test.go: Expected at most 2 requests in flight with max_concurrent_requests = 2, got %d", n)
+		}
+	})
+
+	/* Requests waiting to be retried do not hold a slot */
+	t.Run("retry_backoff", func(t *testing.T) {
+		done := make(chan error)
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, err := client.send_request("GET", "/throttled", "")
+				done <- err
+			}()
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		if _, err := client.send_request("GET", "/ok", ""); err != nil {
+			t.Fatalf("rate_limiter_test.go: %s", err)
+		}
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("rate_limiter_test.go: A request waited %s for a slot held by a request waiting to retry", elapsed)
+		}
+		for i := 0; i < 2; i++ {
+			if err := <-done; err != nil {
+				t.Errorf("rate_limiter_test.go: %s", err)
+			}
+		}
+	})
+
+	t.Run("rate_limit", func(t *testing.T) {
+		limited, limited_svr := new_test_client(t, map[string]http.HandlerFunc{
+			"/ok": func(w http.ResponseWriter, r *http.Request) {},
+		}, &apiClientOpt{rate_limit: 20, rate_limit_burst: 1})
+		defer limited_svr.Close()
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if _, err := limited.send_request("GET", "/ok", ""); err != nil {
+				t.Fatalf("rate_limiter_test.go: %s", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+			t.Errorf("rate_limiter_test.go: 5 requests at 20/s took %s, expected at least 200ms", elapsed)
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package restapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func resourceRestApi() *schema.Resource {
@@ -27,27 +30,142 @@ func resourceRestApi() *schema.Resource {
 			},
 			"create_path": &schema.Schema{
 				Type:        schema.TypeString,
-				Description: "Defaults to `path`. The API path that represents where to CREATE (POST/PUT) objects of this type on the API server. The string `{id}` will be replaced with the terraform ID of the object if the data contains the `id_attribute`. Default method is POST. Use `create_with_put` for PUT.",
+				Description: "Defaults to `path`. The API path that represents where to CREATE (POST/PUT) objects of this type on the API server. Placeholders such as `{id}` or `{data.field}` are replaced as described in `path_variables`, with the values path-escaped. `{id}` is only known if the data contains the `id_attribute`. The method is set by `create_method`.",
 				Optional:    true,
 			},
 			"create_with_put": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "Use the PUT method on CREATE. Shorthand for `create_method = \"PUT\"`.",
+				Optional:    true,
+			},
+			"upsert": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "On CREATE, first read the object and UPDATE it if it already exists, such as when a previous apply failed after creating it. Requires the id to be known before the create (from `data` or `object_id`).",
+				Optional:    true,
+			},
+			"on_conflict": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "What to do when a CREATE fails with `409 Conflict` because the object already exists. `fail` (the default) fails the apply, `adopt` takes over the existing object and `adopt_and_update` also sends `data` to it.",
+				Optional:    true,
+			},
+			"conflict_search_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "When adopting an object on conflict without knowing its id, the object is searched for at `path` like the data source does. This key is used to identify it, with the value of the same key in `data`. The format is 'field/field/field'.",
+				Optional:    true,
+			},
+			"conflict_results_key": &schema.Schema{
 				Type:        schema.TypeString,
-				Description: "Use PUT methon on CREATE.",
+				Description: "Where to find the results array when searching for an object to adopt. The format is 'field/field/field'. If omitted, the response is expected to be the array.",
 				Optional:    true,
 			},
+			"create_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Defaults to `create_method` set on the provider. The HTTP method used to CREATE objects of this type on the API server.",
+				Optional:     true,
+				ValidateFunc: validate_http_method,
+			},
+			"read_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Defaults to `read_method` set on the provider. The HTTP method used to READ objects of this type on the API server.",
+				Optional:     true,
+				ValidateFunc: validate_http_method,
+			},
+			"update_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Defaults to `update_method` set on the provider. The HTTP method used to UPDATE objects of this type on the API server.",
+				Optional:     true,
+				ValidateFunc: validate_http_method,
+			},
+			"destroy_method": &schema.Schema{
+				Type:         schema.TypeString,
+				Description:  "Defaults to `destroy_method` set on the provider. The HTTP method used to DESTROY objects of this type on the API server.",
+				Optional:     true,
+				ValidateFunc: validate_http_method,
+			},
 			"read_path": &schema.Schema{
 				Type:        schema.TypeString,
-				Description: "Defaults to `path/{id}`. The API path that represents where to READ (GET) objects of this type on the API server. The string `{id}` will be replaced with the terraform ID of the object.",
+				Description: "Defaults to `path/{id}`. The API path that represents where to READ (GET) objects of this type on the API server. Placeholders such as `{id}` or `{data.field}` are replaced as described in `path_variables`, with the values path-escaped.",
 				Optional:    true,
 			},
 			"update_path": &schema.Schema{
 				Type:        schema.TypeString,
-				Description: "Defaults to `path/{id}`. The API path that represents where to UPDATE (PUT) objects of this type on the API server. The string `{id}` will be replaced with the terraform ID of the object.",
+				Description: "Defaults to `path/{id}`. The API path that represents where to UPDATE (PUT/PATCH) objects of this type on the API server. Placeholders such as `{id}` or `{data.field}` are replaced as described in `path_variables`, with the values path-escaped.",
 				Optional:    true,
 			},
 			"destroy_path": &schema.Schema{
 				Type:        schema.TypeString,
-				Description: "Defaults to `path/{id}`. The API path that represents where to DESTROY (DELETE) objects of this type on the API server. The string `{id}` will be replaced with the terraform ID of the object.",
+				Description: "Defaults to `path/{id}`. The API path that represents where to DESTROY (DELETE) objects of this type on the API server. Placeholders such as `{id}` or `{data.field}` are replaced as described in `path_variables`, with the values path-escaped.",
+				Optional:    true,
+			},
+			"path_variables": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "Values for `{name}` placeholders in the `*_path` attributes. Placeholders not set here are looked up in `data`, then `api_data`. `{data.field/field}` and `{api_data.field/field}` read from one of them explicitly. All values are URL path-escaped.",
+			},
+			"headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of header names and values to set on all requests for this object. They are set over the `headers` of the provider.",
+			},
+			"create_headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of header names and values to set only when performing a CREATE of this object. They are set over `headers`.",
+			},
+			"read_headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of header names and values to set only when performing a READ of this object. They are set over `headers`.",
+			},
+			"update_headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of header names and values to set only when performing an UPDATE of this object. They are set over `headers`.",
+			},
+			"destroy_headers": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of header names and values to set only when performing a DESTROY of this object. They are set over `headers`.",
+			},
+			"query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of query parameter names and values to add to all requests for this object. Values are escaped.",
+			},
+			"create_query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of query parameter names and values to add only when performing a CREATE of this object. They are set over `query_params`.",
+			},
+			"read_query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of query parameter names and values to add only when performing a READ of this object. They are set over `query_params`.",
+			},
+			"update_query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of query parameter names and values to add only when performing an UPDATE of this object. They are set over `query_params`.",
+			},
+			"destroy_query_params": &schema.Schema{
+				Type:        schema.TypeMap,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "A map of query parameter names and values to add only when performing a DESTROY of this object. They are set over `query_params`.",
+			},
+			"update_body_format": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "How the body of an UPDATE is built. `full` (the default) sends the whole `data`, `merge_patch` sends an RFC 7396 JSON merge patch and `json_patch` sends an RFC 6902 JSON patch of the changes between the previous and the new `data`. Usually combined with `update_method = \"PATCH\"`.",
 				Optional:    true,
 			},
 			"id_attribute": &schema.Schema{
@@ -55,27 +173,204 @@ func resourceRestApi() *schema.Resource {
 				Description: "Defaults to `id_attribute` set on the provider. Allows per-resource override of `id_attribute` (see `id_attribute` provider config documentation)",
 				Optional:    true,
 			},
+			"response_object_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Defaults to `response_object_key` set on the provider. Where to find the object in the responses to reads and writes, for APIs that wrap objects in an envelope. The format is 'field/field/field'.",
+				Optional:    true,
+			},
+			"request_wrapper_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "Defaults to `request_wrapper_key` set on the provider. When set, `data` is wrapped in an object under this key on creates and updates. The format is 'field/field/field'.",
+				Optional:    true,
+			},
+			"create_id_header": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "For APIs that answer a create with the id of the object in a header, such as `201 Created` with `Location: /objects/abc123`. The id is the value of this header, or the last path segment of it for `Location`.",
+				Optional:    true,
+			},
+			"create_id_path": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "For APIs that answer a create with the id of the object somewhere other than the object, such as `{\"result\": {\"id\": 1}}`. Where to find the id in the response. The format is 'field/field/field'.",
+				Optional:    true,
+			},
 			"object_id": &schema.Schema{
 				Type:        schema.TypeString,
 				Description: "Defaults to the id learned by the provider during normal operations and `id_attribute`. Allows you to set the id manually. This is used in conjunction with the `*_path` attributes.",
 				Optional:    true,
 			},
 			"data": &schema.Schema{
-				Type:        schema.TypeString,
-				Description: "Valid JSON data that this provider will manage with the API server.",
-				Required:    true,
+				Type:             schema.TypeString,
+				Description:      "Valid JSON data that this provider will manage with the API server. Formatting, key order and how numbers are written do not cause a change.",
+				Required:         true,
+				DiffSuppressFunc: suppress_equivalent_json,
+			},
+			"ignore_array_order": &schema.Schema{
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "Paths in `data` (in the format 'field/field') of arrays whose order is not significant, such as sets the API returns in random order.",
+			},
+			"ignore_server_changes": &schema.Schema{
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "Paths in `data` (in the format 'field/field', such as `rules/0/port` for array elements) of fields the server legitimately rewrites. Changes to them on the server are not shown as drift.",
 			},
 			"debug": &schema.Schema{
 				Type:        schema.TypeBool,
 				Description: "Whether to emit verbose debug output while working with the API object on the server.",
 				Optional:    true,
 			},
+			"flatten_api_data": &schema.Schema{
+				Type:        schema.TypeBool,
+				Description: "Flatten nested objects and arrays in `api_data` into keys such as `attrs.size` or `colors.0` instead of using the golang fmt package's representation of them.",
+				Optional:    true,
+			},
+			"api_response": &schema.Schema{
+				Type:        schema.TypeString,
+				Description: "The raw JSON of the object as returned by the API server. Use `jsondecode` to access nested values.",
+				Computed:    true,
+			},
 			"api_data": &schema.Schema{
 				Type:        schema.TypeMap,
 				Elem:        &schema.Schema{Type: schema.TypeString},
 				Description: "After data from the API server is read, this map will include k/v pairs usable in other terraform resources as readable objects. Currently the value is the golang fmt package's representation of the value (simple primitives are set as expected, but complex types like arrays and maps contain golang formatting).",
 				Computed:    true,
 			},
+			"read_search": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "For APIs that only list objects. The object is read by searching the listing like the data source does, instead of from `read_path`, and the matching record is used as the object.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"search_path": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Defaults to `path`. The API path that lists the objects.",
+						},
+						"query_string": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "An optional query string to send when performing the search.",
+						},
+						"results_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Where to find the results array in the listing. The format is 'field/field/field'. If omitted, the listing is expected to be the array.",
+						},
+						"search_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The key used to identify the record of the object, such as 'id'. The format is 'field/field/field'.",
+						},
+						"search_value": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Defaults to `{id}`. The value of `search_key` of the record of the object. The string `{id}` will be replaced with the terraform ID of the object.",
+						},
+					},
+				},
+			},
+			"poll": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "For APIs that finish operations in the background. After a create or update, the object is read until the value at `status_key` is one of `success_values`. After a delete, the object is read until the API reports it as not found.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"status_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Where to find the status in the object returned by the API. The format is 'field/field/field', such as `status/phase`. When not set, only deletes are polled.",
+						},
+						"success_values": &schema.Schema{
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "The values of `status_key` that mean the operation finished successfully.",
+						},
+						"failure_values": &schema.Schema{
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "The values of `status_key` that mean the operation failed.",
+						},
+						"interval": &schema.Schema{
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     5,
+							Description: "How long (in seconds) to wait between two reads of the object.",
+						},
+						"timeout": &schema.Schema{
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     600,
+							Description: "How long (in seconds) to wait in total before giving up.",
+						},
+					},
+				},
+			},
+			"operation": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "For APIs that answer a create, update or delete with `202 Accepted` and an `Operation-Location` or `Location` header pointing at an operation resource. The operation is read until it is done, and the object (or its id) is taken from its result.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"location_header": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The response header holding the URL of the operation. Defaults to `Operation-Location`, then `Location`.",
+						},
+						"status_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Where to find the status in the operation resource. The format is 'field/field/field'. When not set, the operation is done once reading it no longer returns `202`.",
+						},
+						"success_values": &schema.Schema{
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "The values of `status_key` that mean the operation finished successfully.",
+						},
+						"failure_values": &schema.Schema{
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Optional:    true,
+							Description: "The values of `status_key` that mean the operation failed.",
+						},
+						"result_key": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Where to find the result in the finished operation. The format is 'field/field/field'. If the value is an object it is used as the object's data, otherwise as its id. When not set, the finished operation resource is the object.",
+						},
+						"interval": &schema.Schema{
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     5,
+							Description: "How long (in seconds) to wait between two reads of the operation.",
+						},
+						"timeout": &schema.Schema{
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     600,
+							Description: "How long (in seconds) to wait in total before giving up.",
+						},
+					},
+				},
+			},
+			"not_found_status_codes": &schema.Schema{
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Optional:    true,
+				Description: "The HTTP response codes the API uses for objects that do not exist (such as 410 or 403). When reading the object returns one of these, it is removed from the state so terraform plans to create it again. Defaults to `[404]`.",
+			},
+			"not_found_body_regex": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "A regular expression that, when it matches the body of a successful read, means the object does not exist. Useful for APIs that keep deleted objects around, such as `\"deleted\":\\s*true`.",
+			},
 			"force_new": &schema.Schema{
 				Type:        schema.TypeList,
 				Elem:        &schema.Schema{Type: schema.TypeString},
@@ -88,23 +383,74 @@ func resourceRestApi() *schema.Resource {
 	}
 }
 
+/* Only report a change to data when the JSON holds different data */
+func suppress_equivalent_json(k, old, new string, d *schema.ResourceData) bool {
+	unordered_paths := make([]string, 0)
+	for _, v := range d.Get("ignore_array_order").([]interface{}) {
+		unordered_paths = append(unordered_paths, v.(string))
+	}
+	return json_equivalent(old, new, unordered_paths)
+}
+
 /* Since there is nothing in the ResourceData structure other
    than the "id" passed on the command line, we have to use an opinionated
    view of the API paths to figure out how to read that object
    from the API */
 func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported []*schema.ResourceData, err error) {
-	input := d.Id()
-	n := strings.LastIndex(input, "/")
-	if n == -1 {
-		return imported, fmt.Errorf("Invalid path to import api_object '%s'. Must be /<full path from server root>/<object id>", input)
+	settings, err := parse_import_id(d.Id())
+	if err != nil {
+		return imported, err
 	}
 
-	path := input[0:n]
-	d.Set("path", path)
+	/* Objects can also be found by searching, like the data source does */
+	search := make(map[string]string)
+	for _, k := range []string{"search_key", "search_value", "results_key", "query_string"} {
+		if v, ok := settings[k]; ok {
+			search[k] = fmt.Sprintf("%v", v)
+			delete(settings, k)
+		}
+	}
 
-	id := input[n+1 : len(input)]
-	d.Set("data", fmt.Sprintf(`{ "id": "%s" }`, id))
-	d.SetId(id)
+	id, ok := settings["id"]
+	if (!ok || fmt.Sprintf("%v", id) == "") && search["search_key"] == "" {
+		return imported, fmt.Errorf("Invalid import id '%s'. Neither the id of the object nor a search_key is set", d.Id())
+	}
+	if search["search_key"] != "" && search["search_value"] == "" {
+		return imported, fmt.Errorf("Invalid import id '%s'. search_value must be set along with search_key", d.Id())
+	}
+	delete(settings, "id")
+	if _, ok := settings["path"]; !ok {
+		return imported, fmt.Errorf("Invalid import id '%s'. The path of the object is not set", d.Id())
+	}
+
+	/* Everything else sets the attribute of the same name,
+	   such as read_path or id_attribute */
+	resource_schema := resourceRestApi().Schema
+	for k, v := range settings {
+		attr, ok := resource_schema[k]
+		if !ok || attr.Computed || k == "data" {
+			return imported, fmt.Errorf("Invalid import id '%s'. '%s' cannot be set when importing", d.Id(), k)
+		}
+		value, err := import_value(attr, v)
+		if err != nil {
+			return imported, fmt.Errorf("Invalid import id '%s'. Bad value for '%s': %s", d.Id(), k, err)
+		}
+		d.Set(k, value)
+	}
+
+	if search["search_key"] != "" {
+		d.SetId("")
+		obj, err := make_api_object(d, meta)
+		if err != nil {
+			return imported, err
+		}
+		if err := obj.find_object(search["query_string"], search["search_key"], search["search_value"], search["results_key"]); err != nil {
+			return imported, err
+		}
+		log.Printf("resource_api_object.go: Import found object '%s' where '%s' = '%s'\n", obj.id, search["search_key"], search["search_value"])
+		id = obj.id
+	}
+	d.SetId(fmt.Sprintf("%v", id))
 
 	/* Troubleshooting is hard enough. Emit log messages so TF_LOG
 	   has useful information in case an import isn't working */
@@ -118,6 +464,15 @@ func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported [
 
 	if err := obj.read_object(); err == nil {
 		set_resource_state(obj, d)
+
+		/* Start data from the object on the server, so the
+		   first plan after the import is clean if it matches */
+		data, err := json.Marshal(obj.api_data)
+		if err != nil {
+			return imported, err
+		}
+		d.Set("data", string(data))
+
 		/* Data that we set in the state above must be passed along
 		   as an item in the stack of imported data */
 		imported = append(imported, d)
@@ -126,6 +481,85 @@ func resourceRestApiImport(d *schema.ResourceData, meta interface{}) (imported [
 	return imported, err
 }
 
+/* Parse an import id in one of these formats:
+     /<full path from server root>/<object id>
+     path=/api/objects,id=1234,read_path=/api/objects/{id}
+     { "path": "/api/objects", "id": "1234", "headers": { "Accept": "..." } }
+   Instead of the id, search_key and search_value (and optionally
+   results_key and query_string) find the object by searching path */
+func parse_import_id(input string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(input), "{"):
+		if err := json_decode(input, &settings); err != nil {
+			return nil, fmt.Errorf("Invalid import id '%s'. It is not valid JSON: %s", input, err)
+		}
+	case is_import_pairs(input):
+		for _, pair := range strings.Split(input, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			settings[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	default:
+		n := strings.LastIndex(input, "/")
+		if n == -1 {
+			return nil, fmt.Errorf("Invalid path to import api_object '%s'. Must be /<full path from server root>/<object id>, key=value pairs or a JSON object", input)
+		}
+		settings["path"] = input[0:n]
+		settings["id"] = input[n+1:]
+	}
+
+	return settings, nil
+}
+
+/* Whether an import id is key=value pairs rather than a path. Paths
+   may contain = too, such as /v1/name=foo/123, so every key must be
+   one the import understands */
+func is_import_pairs(input string) bool {
+	attrs := resourceRestApi().Schema
+	for _, pair := range strings.Split(input, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		switch key := strings.TrimSpace(parts[0]); key {
+		case "id", "search_key", "search_value", "results_key", "query_string":
+		default:
+			if _, ok := attrs[key]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/* Convert a value from an import id to the type of the attribute */
+func import_value(attr *schema.Schema, v interface{}) (interface{}, error) {
+	switch attr.Type {
+	case schema.TypeString:
+		switch v.(type) {
+		case string, json.Number:
+			return fmt.Sprintf("%v", v), nil
+		}
+	case schema.TypeBool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			return strconv.ParseBool(b)
+		}
+	case schema.TypeMap:
+		if m, ok := v.(map[string]interface{}); ok {
+			values := make(map[string]interface{})
+			for k, v := range m {
+				values[k] = fmt.Sprintf("%v", v)
+			}
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("a %T cannot be used for this attribute", v)
+}
+
 func resourceRestApiCreate(d *schema.ResourceData, meta interface{}) error {
 	obj, err := make_api_object(d, meta)
 	if err != nil {
@@ -134,9 +568,13 @@ func resourceRestApiCreate(d *schema.ResourceData, meta interface{}) error {
 	log.Printf("resource_api_object.go: Create routine called. Object built:\n%s\n", obj.toString())
 
 	err = obj.create_object()
-	if err == nil {
-		/* Setting terraform ID tells terraform the object was created or it exists */
+	if obj.id != "" && obj.created {
+		/* Setting terraform ID tells terraform the object was created or it exists.
+		   This is done even if waiting for the object failed, so terraform
+		   taints the resource instead of losing track of the object */
 		d.SetId(obj.id)
+	}
+	if err == nil {
 		set_resource_state(obj, d)
 	}
 	return err
@@ -155,6 +593,12 @@ func resourceRestApiRead(d *schema.ResourceData, meta interface{}) error {
 		log.Printf("resource_api_object.go: Read resource. Returned id is '%s'\n", obj.id)
 		d.SetId(obj.id)
 		set_resource_state(obj, d)
+		err = set_server_changes(obj, d)
+	} else if obj.is_not_found(err) {
+		/* Deleted outside of terraform. Clearing the ID lets terraform plan to create it again */
+		log.Printf("resource_api_object.go: Object '%s' no longer exists on the server. Removing it from state: %s\n", obj.id, err)
+		d.SetId("")
+		err = nil
 	}
 	return err
 }
@@ -192,11 +636,9 @@ func resourceRestApiDelete(d *schema.ResourceData, meta interface{}) error {
 	log.Printf("resource_api_object.go: Delete routine called. Object built:\n%s\n", obj.toString())
 
 	err = obj.delete_object()
-	if err != nil {
-		if strings.Contains(err.Error(), "404") {
-			/* 404 means it doesn't exist. Call that good enough */
-			err = nil
-		}
+	if obj.is_not_found(err) {
+		/* 404 (or the configured equivalent) means it doesn't exist. Call that good enough */
+		err = nil
 	}
 	return err
 }
@@ -208,10 +650,13 @@ func resourceRestApiExists(d *schema.ResourceData, meta interface{}) (exists boo
 	}
 	log.Printf("resource_api_object.go: Exists routine called. Object built: %s\n", obj.toString())
 
-	/* Assume all errors indicate the object just doesn't exist.
-	This may not be a good assumption... */
-	if err := obj.read_object(); err == nil {
+	/* Only a 404 (or the configured equivalent) means the object is gone.
+	   Anything else (such as a 500) must not remove it from the state */
+	err = obj.read_object()
+	if err == nil {
 		exists = true
+	} else if obj.is_not_found(err) {
+		err = nil
 	}
 	return exists, err
 }
@@ -244,6 +689,20 @@ func buildApiObjectOpts(d *schema.ResourceData) (*apiObjectOpts, error) {
 		opts.id_attribute = v.(string)
 	}
 
+	if v, ok := d.GetOk("response_object_key"); ok {
+		opts.response_object_key = v.(string)
+	}
+	if v, ok := d.GetOk("request_wrapper_key"); ok {
+		opts.request_wrapper_key = v.(string)
+	}
+
+	if v, ok := d.GetOk("create_id_header"); ok {
+		opts.create_id_header = v.(string)
+	}
+	if v, ok := d.GetOk("create_id_path"); ok {
+		opts.create_id_path = v.(string)
+	}
+
 	/* Allow user to specify the ID manually */
 	if v, ok := d.GetOk("object_id"); ok {
 		opts.id = v.(string)
@@ -261,6 +720,42 @@ func buildApiObjectOpts(d *schema.ResourceData) (*apiObjectOpts, error) {
 	if v, ok := d.GetOk("create_with_put"); ok {
 		opts.create_with_put = v.(bool)
 	}
+	if v, ok := d.GetOk("upsert"); ok {
+		opts.upsert = v.(bool)
+	}
+	if v, ok := d.GetOk("on_conflict"); ok {
+		opts.on_conflict = v.(string)
+	}
+	if v, ok := d.GetOk("conflict_search_key"); ok {
+		opts.conflict_search_key = v.(string)
+	}
+	if v, ok := d.GetOk("conflict_results_key"); ok {
+		opts.conflict_results_key = v.(string)
+	}
+	if v, ok := d.GetOk("create_method"); ok {
+		opts.create_method = v.(string)
+	}
+	if v, ok := d.GetOk("read_method"); ok {
+		opts.read_method = v.(string)
+	}
+	if v, ok := d.GetOk("update_method"); ok {
+		opts.update_method = v.(string)
+	}
+	if v, ok := d.GetOk("destroy_method"); ok {
+		opts.destroy_method = v.(string)
+	}
+	opts.path_variables = expand_string_map(d.Get("path_variables"))
+	opts.api_data = expand_string_map(d.Get("api_data"))
+	opts.headers = expand_string_map(d.Get("headers"))
+	opts.create_headers = expand_string_map(d.Get("create_headers"))
+	opts.read_headers = expand_string_map(d.Get("read_headers"))
+	opts.update_headers = expand_string_map(d.Get("update_headers"))
+	opts.destroy_headers = expand_string_map(d.Get("destroy_headers"))
+	opts.query_params = expand_string_map(d.Get("query_params"))
+	opts.create_query_params = expand_string_map(d.Get("create_query_params"))
+	opts.read_query_params = expand_string_map(d.Get("read_query_params"))
+	opts.update_query_params = expand_string_map(d.Get("update_query_params"))
+	opts.destroy_query_params = expand_string_map(d.Get("destroy_query_params"))
 	if v, ok := d.GetOk("read_path"); ok {
 		opts.get_path = v.(string)
 	}
@@ -271,6 +766,63 @@ func buildApiObjectOpts(d *schema.ResourceData) (*apiObjectOpts, error) {
 		opts.delete_path = v.(string)
 	}
 
+	if v, ok := d.GetOk("read_search"); ok {
+		read_search_config := v.([]interface{})[0].(map[string]interface{})
+		opts.search_path = read_search_config["search_path"].(string)
+		opts.read_search = &readSearchOpt{
+			search_key:   read_search_config["search_key"].(string),
+			search_value: read_search_config["search_value"].(string),
+			results_key:  read_search_config["results_key"].(string),
+			query_string: read_search_config["query_string"].(string),
+		}
+	}
+	if v, ok := d.GetOk("poll"); ok {
+		poll_config := v.([]interface{})[0].(map[string]interface{})
+		opts.poll = &pollOpt{
+			status_key: poll_config["status_key"].(string),
+			interval:   time.Second * time.Duration(poll_config["interval"].(int)),
+			timeout:    time.Second * time.Duration(poll_config["timeout"].(int)),
+		}
+		for _, v := range poll_config["success_values"].([]interface{}) {
+			opts.poll.success_values = append(opts.poll.success_values, v.(string))
+		}
+		for _, v := range poll_config["failure_values"].([]interface{}) {
+			opts.poll.failure_values = append(opts.poll.failure_values, v.(string))
+		}
+	}
+	if v, ok := d.GetOk("operation"); ok {
+		operation_config := v.([]interface{})[0].(map[string]interface{})
+		opts.operation = &operationOpt{
+			location_header: operation_config["location_header"].(string),
+			status_key:      operation_config["status_key"].(string),
+			result_key:      operation_config["result_key"].(string),
+			interval:        time.Second * time.Duration(operation_config["interval"].(int)),
+			timeout:         time.Second * time.Duration(operation_config["timeout"].(int)),
+		}
+		for _, v := range operation_config["success_values"].([]interface{}) {
+			opts.operation.success_values = append(opts.operation.success_values, v.(string))
+		}
+		for _, v := range operation_config["failure_values"].([]interface{}) {
+			opts.operation.failure_values = append(opts.operation.failure_values, v.(string))
+		}
+	}
+	if v, ok := d.GetOk("not_found_status_codes"); ok {
+		for _, code := range v.([]interface{}) {
+			opts.not_found_status_codes = append(opts.not_found_status_codes, code.(int))
+		}
+	}
+	if v, ok := d.GetOk("not_found_body_regex"); ok {
+		opts.not_found_body_regex = v.(string)
+	}
+
+	opts.update_body_format = d.Get("update_body_format").(string)
+
+	/* Patches are computed from what data was before this change */
+	if d.HasChange("data") {
+		old_data, _ := d.GetChange("data")
+		opts.previous_data = old_data.(string)
+	}
+
 	opts.data = d.Get("data").(string)
 	opts.debug = d.Get("debug").(bool)
 
@@ -17,6 +17,9 @@ import (
 	"github.com/Mastercard/terraform-provider-restapi/fakeserver"
 	mylog "github.com/Mastercard/terraform-provider-restapi/log"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"net/http"
 	"os"
 	"testing"
 )
@@ -71,6 +74,27 @@ func TestAccRestApiObject_Basic(t *testing.T) {
 					resource.TestCheckResourceAttr("restapi_object.Foo", "api_data.last", "Bar"),
 				),
 			},
+			/* Change the object behind terraform's back. The drift
+			   shows up in the plan and is reverted by the apply */
+			{
+				PreConfig: func() {
+					api_server_objects["1234"]["first"] = "Changed"
+				},
+				Config: generate_test_resource(
+					"Foo",
+					`{ "id": "1234", "first": "Foo", "last": "Bar" }`,
+					make(map[string]interface{}),
+				),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("restapi_object.Foo", "api_data.first", "Foo"),
+					func(s *terraform.State) error {
+						if api_server_objects["1234"]["first"] != "Foo" {
+							return fmt.Errorf("Expected the change on the server to be reverted, but first is '%v'", api_server_objects["1234"]["first"])
+						}
+						return nil
+					},
+				),
+			},
 			/* Make a complex object with id_attribute as a child of another key
 			   Note that we have to pass "id" just so fakeserver won't get angry at us
 			*/
@@ -95,6 +119,49 @@ func TestAccRestApiObject_Basic(t *testing.T) {
 	svr.Shutdown()
 }
 
+/* An object that was created but never became ready must stay
+   in the state, so terraform taints it instead of orphaning it */
+func TestRestApiObjectCreateKeepsID(t *testing.T) {
+	client, svr := new_test_client(t, map[string]http.HandlerFunc{
+		"/api/objects": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{ "id": "1", "status": "failed" }`))
+		},
+		"/api/objects/1": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{ "id": "1", "status": "failed" }`))
+		},
+	}, &apiClientOpt{write_returns_object: true})
+	defer svr.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRestApi().Schema, map[string]interface{}{
+		"path": "/api/objects",
+		"data": `{ "name": "foo" }`,
+		"poll": []interface{}{
+			map[string]interface{}{
+				"status_key":     "status",
+				"success_values": []interface{}{"ready"},
+				"failure_values": []interface{}{"failed"},
+				"interval":       1,
+				"timeout":        1,
+			},
+		},
+	})
+	if err := resourceRestApiCreate(d, client); err == nil {
+		t.Fatalf("resource_api_object_test.go: Expected the create to fail on the failed status")
+	}
+	if d.Id() != "1" {
+		t.Fatalf("resource_api_object_test.go: Expected id '1' to be kept after the failed poll, got '%s'", d.Id())
+	}
+
+	/* Nothing was created, so there is nothing to keep */
+	d = schema.TestResourceDataRaw(t, resourceRestApi().Schema, map[string]interface{}{
+		"path": "/missing",
+		"data": `{ "id": "2" }`,
+	})
+	if err := resourceRestApiCreate(d, client); err == nil || d.Id() != "" {
+		t.Fatalf("resource_api_object_test.go: Expected a failed create without an id, got '%s' and %v", d.Id(), err)
+	}
+}
+
 /* This function generates a terraform JSON configuration from
    a name, JSON data and a list of params to set by coaxing it
    all to maps and then serializing to JSON */